@@ -0,0 +1,138 @@
+package dynamicformula
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ContextColumns 是 ContextInput 批量数据的列式表示：每个可选字段存为一列值与一列存在标记，
+// 相比逐行持有指针显著减少大批量场景下的分配次数。Mask 为 false 的位置表示缺失值，对应的值无意义。
+type ContextColumns struct {
+	Period []int
+
+	ObservedQ     []float64
+	ObservedQMask []bool
+	ObservedP     []float64
+	ObservedPMask []bool
+	ObservedV     []float64
+	ObservedVMask []bool
+
+	AggregateQ     []float64
+	AggregateQMask []bool
+	AggregateP     []float64
+	AggregatePMask []bool
+	AggregateV     []float64
+	AggregateVMask []bool
+
+	BaselineQ     []float64
+	BaselineQMask []bool
+	BaselineP     []float64
+	BaselinePMask []bool
+	BaselineV     []float64
+	BaselineVMask []bool
+
+	ScenarioAQ     []float64
+	ScenarioAQMask []bool
+	ScenarioAP     []float64
+	ScenarioAPMask []bool
+	ScenarioAV     []float64
+	ScenarioAVMask []bool
+
+	ScenarioBQ     []float64
+	ScenarioBQMask []bool
+	ScenarioBP     []float64
+	ScenarioBPMask []bool
+	ScenarioBV     []float64
+	ScenarioBVMask []bool
+
+	OverheadQ     []float64
+	OverheadQMask []bool
+	OverheadP     []float64
+	OverheadPMask []bool
+	OverheadV     []float64
+	OverheadVMask []bool
+}
+
+// Len 返回列式数据的行数。
+func (c ContextColumns) Len() int {
+	return len(c.Period)
+}
+
+// columnField 记录一个可选字段在 ContextInput 与 ContextColumns 中的位置，避免逐行按名反射。
+type columnField struct {
+	name    string
+	context int
+	values  int
+	mask    int
+}
+
+var columnFields = func() []columnField {
+	contextType := reflect.TypeOf(ContextInput{})
+	columnsType := reflect.TypeOf(ContextColumns{})
+	fields := make([]columnField, 0, len(optionalFloatFields))
+	for _, name := range optionalFloatFields {
+		ctx, _ := contextType.FieldByName(name)
+		values, _ := columnsType.FieldByName(name)
+		mask, _ := columnsType.FieldByName(name + "Mask")
+		fields = append(fields, columnField{
+			name:    name,
+			context: ctx.Index[0],
+			values:  values.Index[0],
+			mask:    mask.Index[0],
+		})
+	}
+	return fields
+}()
+
+// Row 还原第 i 行为 ContextInput，缺失值还原为 nil。
+func (c ContextColumns) Row(i int) ContextInput {
+	row := ContextInput{Period: c.Period[i]}
+	cols := reflect.ValueOf(c)
+	out := reflect.ValueOf(&row).Elem()
+	for _, f := range columnFields {
+		if cols.Field(f.mask).Index(i).Bool() {
+			value := cols.Field(f.values).Index(i).Float()
+			out.Field(f.context).Set(reflect.ValueOf(NewOptionalFloat(value)))
+		}
+	}
+	return row
+}
+
+// ColumnsFromRows 将 ContextInput 切片转换为列式表示。
+func ColumnsFromRows(rows []ContextInput) ContextColumns {
+	var c ContextColumns
+	c.Period = make([]int, len(rows))
+	cols := reflect.ValueOf(&c).Elem()
+	for _, f := range columnFields {
+		cols.Field(f.values).Set(reflect.ValueOf(make([]float64, len(rows))))
+		cols.Field(f.mask).Set(reflect.ValueOf(make([]bool, len(rows))))
+	}
+
+	for i := range rows {
+		c.Period[i] = rows[i].Period
+		in := reflect.ValueOf(&rows[i]).Elem()
+		for _, f := range columnFields {
+			value := in.Field(f.context).Interface().(*OptionalFloat)
+			if value == nil {
+				continue
+			}
+			cols.Field(f.values).Index(i).SetFloat(float64(*value))
+			cols.Field(f.mask).Index(i).SetBool(true)
+		}
+	}
+	return c
+}
+
+// Validate 检查所有列的长度是否与 Period 一致。
+func (c ContextColumns) Validate() error {
+	cols := reflect.ValueOf(c)
+	for _, f := range columnFields {
+		if n := cols.Field(f.values).Len(); n != len(c.Period) {
+			return fmt.Errorf("column %s has %d rows, want %d", f.name, n, len(c.Period))
+		}
+		if n := cols.Field(f.mask).Len(); n != len(c.Period) {
+			return fmt.Errorf("column %sMask has %d rows, want %d", f.name, n, len(c.Period))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package dynamicformula
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestContextColumns_RoundTrip(t *testing.T) {
+	rows := samplePeriodInputs()
+	rows[1].BaselineQ = nil
+	rows[2].ObservedV = NewOptionalFloat(0)
+	rows[2].ScenarioBP = nil
+
+	cols := ColumnsFromRows(rows)
+	if err := cols.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cols.Len() != len(rows) {
+		t.Fatalf("Len = %d, want %d", cols.Len(), len(rows))
+	}
+	if cols.BaselineQMask[1] || !cols.ObservedVMask[2] || cols.ObservedV[2] != 0 {
+		t.Fatal("masks do not reflect nil/present-zero distinction")
+	}
+
+	for i, want := range rows {
+		got := cols.Row(i)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("row %d mismatch:\n got %+v\nwant %+v", i, got, want)
+		}
+	}
+	if cols.Row(1).BaselineQ != nil || cols.Row(2).ScenarioBP != nil {
+		t.Fatal("nil fields must round-trip as nil")
+	}
+}
@@ -0,0 +1,45 @@
+package dynamicformula
+
+import "time"
+
+// CriticalPath 返回模板执行图中按节点数计的最长依赖链（含输入节点），它决定了并行执行的耗时下界。
+// 长度相同时优先选择 Requires 中靠前的依赖以及执行顺序中靠前的终点。
+func (t *CalcTemplate) CriticalPath() ([]string, error) {
+	return t.criticalPath(func(string) time.Duration { return 1 })
+}
+
+// CriticalPathByDuration 按实测耗时（如 EvaluationReport.Timings）计算关键路径，缺少耗时的节点按 0 计。
+func (t *CalcTemplate) CriticalPathByDuration(timings map[string]time.Duration) ([]string, error) {
+	return t.criticalPath(func(name string) time.Duration { return timings[name] })
+}
+
+func (t *CalcTemplate) criticalPath(weight func(string) time.Duration) ([]string, error) {
+	ordered, err := t.GetOrderedNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	length := make(map[string]time.Duration, len(ordered))
+	prev := make(map[string]string, len(ordered))
+	end := ""
+	for _, n := range ordered {
+		name := n.Name()
+		best, bestDep := time.Duration(0), ""
+		for _, dep := range t.depsOf(n) {
+			if l, ok := length[dep]; ok && (bestDep == "" || l > best) {
+				best, bestDep = l, dep
+			}
+		}
+		length[name] = best + weight(name)
+		prev[name] = bestDep
+		if end == "" || length[name] > length[end] {
+			end = name
+		}
+	}
+
+	var path []string
+	for name := end; name != ""; name = prev[name] {
+		path = append([]string{name}, path...)
+	}
+	return path, nil
+}
@@ -0,0 +1,33 @@
+package dynamicformula
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCalcTemplate_CriticalPath(t *testing.T) {
+	path, err := NewFullCalcTemplate().CriticalPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{KeyAggregateMetrics, KeySettlementImpact, KeyNetMargin, KeyUnitYield}
+	if !reflect.DeepEqual(path, want) {
+		t.Fatalf("CriticalPath() = %v, want %v", path, want)
+	}
+
+	timings := map[string]time.Duration{
+		KeyBaseCost:         10 * time.Millisecond,
+		KeyTotalCost:        5 * time.Millisecond,
+		KeySettlementImpact: time.Millisecond,
+		KeyNetMargin:        time.Millisecond,
+		KeyUnitYield:        time.Millisecond,
+	}
+	path, err = NewFullCalcTemplate().CriticalPathByDuration(timings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path[len(path)-1] != KeyTotalCost || path[len(path)-2] != KeyBaseCost {
+		t.Fatalf("CriticalPathByDuration() = %v, want a path ending base_cost -> total_cost", path)
+	}
+}
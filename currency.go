@@ -0,0 +1,104 @@
+package dynamicformula
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/force-c/dynamic-formula/utils"
+)
+
+// currencyMinorUnits 是常用货币的 ISO 4217 小数位数。
+var currencyMinorUnits = map[string]int{
+	"AUD": 2, "BHD": 3, "BRL": 2, "CAD": 2, "CHF": 2, "CLP": 0, "CNY": 2, "CZK": 2,
+	"DKK": 2, "EUR": 2, "GBP": 2, "HKD": 2, "HUF": 2, "IDR": 2, "ILS": 2, "INR": 2,
+	"IQD": 3, "ISK": 0, "JOD": 3, "JPY": 0, "KRW": 0, "KWD": 3, "LYD": 3, "MXN": 2,
+	"MYR": 2, "NOK": 2, "NZD": 2, "OMR": 3, "PHP": 2, "PLN": 2, "RUB": 2, "SAR": 2,
+	"SEK": 2, "SGD": 2, "THB": 2, "TND": 3, "TRY": 2, "TWD": 2, "UGX": 0, "USD": 2,
+	"VND": 0, "XAF": 0, "XOF": 0, "ZAR": 2,
+}
+
+var (
+	currencyMutex         sync.RWMutex
+	currencyOverrides     = make(map[string]int)
+	defaultCurrencyPlaces = -1
+)
+
+// SetCurrencyPrecision 覆盖或补充某个货币代码的小数位数，优先于内置表。
+func SetCurrencyPrecision(code string, places int) {
+	currencyMutex.Lock()
+	defer currencyMutex.Unlock()
+	currencyOverrides[strings.ToUpper(code)] = places
+}
+
+// SetDefaultCurrencyPrecision 设置未知货币代码使用的小数位数，传入负数恢复为报错。
+func SetDefaultCurrencyPrecision(places int) {
+	currencyMutex.Lock()
+	defer currencyMutex.Unlock()
+	defaultCurrencyPlaces = places
+}
+
+// CurrencyPrecision 返回货币代码的小数位数，依次查找覆盖表、内置表与默认值。
+func CurrencyPrecision(code string) (int, error) {
+	code = strings.ToUpper(code)
+	currencyMutex.RLock()
+	defer currencyMutex.RUnlock()
+	if places, ok := currencyOverrides[code]; ok {
+		return places, nil
+	}
+	if places, ok := currencyMinorUnits[code]; ok {
+		return places, nil
+	}
+	if defaultCurrencyPlaces >= 0 {
+		return defaultCurrencyPlaces, nil
+	}
+	return 0, fmt.Errorf("unknown currency code %q", code)
+}
+
+// RoundCurrency 按货币的最小单位精度对金额做十进制四舍五入。
+func RoundCurrency(value float64, currencyCode string) (float64, error) {
+	places, err := CurrencyPrecision(currencyCode)
+	if err != nil {
+		return 0, err
+	}
+	return utils.DecimalRound(value, places), nil
+}
+
+// ConvertResults 返回结果副本，其中 keys 指定的数值结果按汇率 rate 做十进制乘法换算，其余结果原样保留。
+// rate 必须为正；结果中不存在的键跳过，非 float64 的键返回错误。
+func ConvertResults(results map[string]interface{}, rate float64, keys []string) (map[string]interface{}, error) {
+	if !(rate > 0) || math.IsInf(rate, 0) {
+		return nil, fmt.Errorf("fx rate must be positive, got %v", rate)
+	}
+	converted := make(map[string]interface{}, len(results))
+	for k, v := range results {
+		converted[k] = v
+	}
+	for _, key := range keys {
+		v, ok := results[key]
+		if !ok {
+			continue
+		}
+		f, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("result %s is %T, not a number", key, v)
+		}
+		converted[key] = utils.DecimalMul(f, rate)
+	}
+	return converted, nil
+}
+
+// ConvertResultsFromMeta 以 Meta["fx_rate"] 为汇率调用 ConvertResults；未设置汇率时原样返回 results。
+func (m ContextInput) ConvertResultsFromMeta(results map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	raw, ok := m.Meta["fx_rate"]
+	if !ok {
+		return results, nil
+	}
+	rate, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fx rate %q", raw)
+	}
+	return ConvertResults(results, rate, keys)
+}
@@ -0,0 +1,105 @@
+package dynamicformula
+
+import (
+	"testing"
+
+	"github.com/force-c/dynamic-formula/utils"
+)
+
+func TestRoundCurrency(t *testing.T) {
+	if got, err := RoundCurrency(1234.5678, "JPY"); err != nil || got != 1235 {
+		t.Fatalf("JPY = %v, %v", got, err)
+	}
+	if got, err := RoundCurrency(1234.5678, "usd"); err != nil || got != 1234.57 {
+		t.Fatalf("USD = %v, %v", got, err)
+	}
+	if got, err := RoundCurrency(1.23456, "KWD"); err != nil || got != 1.235 {
+		t.Fatalf("KWD = %v, %v", got, err)
+	}
+	if _, err := RoundCurrency(1, "XYZ"); err == nil {
+		t.Fatal("expected error for unknown currency")
+	}
+
+	SetDefaultCurrencyPrecision(1)
+	SetCurrencyPrecision("JPY", 1)
+	defer func() {
+		SetDefaultCurrencyPrecision(-1)
+		currencyMutex.Lock()
+		delete(currencyOverrides, "JPY")
+		currencyMutex.Unlock()
+	}()
+	if got, err := RoundCurrency(1.26, "XYZ"); err != nil || got != 1.3 {
+		t.Fatalf("default precision = %v, %v", got, err)
+	}
+	if got, err := RoundCurrency(1.26, "JPY"); err != nil || got != 1.3 {
+		t.Fatalf("override precision = %v, %v", got, err)
+	}
+}
+
+func TestCalc_CurrencyRounding(t *testing.T) {
+	template := NewFullCalcTemplate().WithRounding(RoundingPolicy{Mode: RoundToCurrency})
+
+	input := samplePeriodInputs()[0]
+	input.Meta = map[string]string{"currency": "JPY"}
+	data, err := input.Calc(template, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertResultClose(t, data, KeyTotalCost, 15, 0)
+	AssertResultClose(t, data, KeyBaseCost, 15, 0)
+	// unit_yield 量纲为 value/quantity，不按货币舍入。
+	AssertResultClose(t, data, KeyUnitYield, 0.14, 1e-9)
+
+	input.Meta = nil
+	if _, err := input.Calc(template, false); err == nil {
+		t.Fatal("expected error when currency metadata is missing")
+	}
+}
+
+func TestConvertResults(t *testing.T) {
+	input := samplePeriodInputs()[0]
+	results, err := input.Calc(NewFullCalcTemplate(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{KeyTotalCost, KeyNetMargin}
+
+	converted, err := ConvertResults(results, 7.1, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		want := utils.DecimalMul(results[key].(float64), 7.1)
+		if converted[key] != want {
+			t.Errorf("%s = %v, want %v", key, converted[key], want)
+		}
+	}
+	// total_cost 15.4 × 7.1。
+	AssertResultClose(t, converted, KeyTotalCost, 109.34, 0)
+	for key, v := range results {
+		if key == KeyTotalCost || key == KeyNetMargin {
+			continue
+		}
+		if converted[key] != v {
+			t.Errorf("unselected %s changed: %v -> %v", key, v, converted[key])
+		}
+	}
+	if results[KeyTotalCost] != 15.4 {
+		t.Fatalf("input results modified: total_cost = %v", results[KeyTotalCost])
+	}
+
+	for _, rate := range []float64{0, -1} {
+		if _, err := ConvertResults(results, rate, keys); err == nil {
+			t.Errorf("expected error for rate %v", rate)
+		}
+	}
+
+	input.Meta = map[string]string{"fx_rate": "7.1"}
+	fromMeta, err := input.ConvertResultsFromMeta(results, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromMeta[KeyTotalCost] != converted[KeyTotalCost] {
+		t.Fatalf("Meta conversion total_cost = %v, want %v", fromMeta[KeyTotalCost], converted[KeyTotalCost])
+	}
+}
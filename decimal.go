@@ -0,0 +1,48 @@
+package dynamicformula
+
+import "github.com/shopspring/decimal"
+
+// OptionalDecimal 用于包装 decimal.Decimal，nil 指针表示缺失值，适合不经 float64 转换的列式十进制批次。
+type OptionalDecimal decimal.Decimal
+
+// NewOptionalDecimal 返回 OptionalDecimal 指针。
+func NewOptionalDecimal(d decimal.Decimal) *OptionalDecimal {
+	v := OptionalDecimal(d)
+	return &v
+}
+
+// Decimal 返回底层的 decimal.Decimal。
+func (d OptionalDecimal) Decimal() decimal.Decimal {
+	return decimal.Decimal(d)
+}
+
+// SumOptionalDecimals 对存在的值求和，跳过缺失值；全部缺失（或切片为空）时返回 nil。
+func SumOptionalDecimals(vals []*OptionalDecimal) *OptionalDecimal {
+	sum, count := sumPresent(vals)
+	if count == 0 {
+		return nil
+	}
+	return NewOptionalDecimal(sum)
+}
+
+// AvgOptionalDecimals 对存在的值求平均，跳过缺失值；全部缺失（或切片为空）时返回 nil。
+func AvgOptionalDecimals(vals []*OptionalDecimal) *OptionalDecimal {
+	sum, count := sumPresent(vals)
+	if count == 0 {
+		return nil
+	}
+	return NewOptionalDecimal(sum.Div(decimal.NewFromInt(int64(count))))
+}
+
+func sumPresent(vals []*OptionalDecimal) (decimal.Decimal, int) {
+	sum := decimal.Zero
+	count := 0
+	for _, v := range vals {
+		if v == nil {
+			continue
+		}
+		sum = sum.Add(v.Decimal())
+		count++
+	}
+	return sum, count
+}
@@ -0,0 +1,33 @@
+package dynamicformula
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestOptionalDecimalAggregates(t *testing.T) {
+	vals := []*OptionalDecimal{
+		NewOptionalDecimal(decimal.RequireFromString("0.1")),
+		nil,
+		NewOptionalDecimal(decimal.RequireFromString("0.2")),
+		NewOptionalDecimal(decimal.RequireFromString("0.3")),
+		nil,
+	}
+	sum := SumOptionalDecimals(vals)
+	if sum == nil || !sum.Decimal().Equal(decimal.RequireFromString("0.6")) {
+		t.Fatalf("sum = %v, want 0.6", sum)
+	}
+	avg := AvgOptionalDecimals(vals)
+	if avg == nil || !avg.Decimal().Equal(decimal.RequireFromString("0.2")) {
+		t.Fatalf("avg = %v, want 0.2", avg)
+	}
+
+	absent := []*OptionalDecimal{nil, nil}
+	if SumOptionalDecimals(absent) != nil || AvgOptionalDecimals(absent) != nil {
+		t.Fatal("all-absent input must yield absent result")
+	}
+	if SumOptionalDecimals(nil) != nil {
+		t.Fatal("empty input must yield absent result")
+	}
+}
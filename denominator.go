@@ -0,0 +1,45 @@
+package dynamicformula
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ZeroDenominatorPolicy 决定 unit_yield 等比值公式在分母为零时的行为。
+type ZeroDenominatorPolicy int
+
+const (
+	// ZeroDenominatorZero 返回 0（默认），与历史行为兼容。
+	ZeroDenominatorZero ZeroDenominatorPolicy = iota
+	// ZeroDenominatorNaN 返回 NaN，区分“收益为零”与“收益无定义”。
+	ZeroDenominatorNaN
+	// ZeroDenominatorError 返回 ErrZeroDenominator。
+	ZeroDenominatorError
+)
+
+// ErrZeroDenominator 表示比值公式的分母为零且策略为 ZeroDenominatorError。
+var ErrZeroDenominator = errors.New("zero denominator")
+
+// zeroDenominatorKey 是分母为零策略在依赖结果中的保留键，仅在非默认策略时写入。
+const zeroDenominatorKey = "$zero_denominator"
+
+// WithZeroDenominatorPolicy 返回使用指定分母为零策略的模板副本。
+func (t *CalcTemplate) WithZeroDenominatorPolicy(policy ZeroDenominatorPolicy) *CalcTemplate {
+	clone := t.clone()
+	clone.zeroDenominator = policy
+	return clone
+}
+
+// zeroDenominatorResult 按 prev 中携带的策略返回分母为零时的结果。
+func zeroDenominatorResult(prev map[string]interface{}, name string) (float64, error) {
+	policy, _ := prev[zeroDenominatorKey].(ZeroDenominatorPolicy)
+	switch policy {
+	case ZeroDenominatorNaN:
+		return math.NaN(), nil
+	case ZeroDenominatorError:
+		return 0, fmt.Errorf("%s: %w", name, ErrZeroDenominator)
+	default:
+		return 0, nil
+	}
+}
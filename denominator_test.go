@@ -0,0 +1,61 @@
+package dynamicformula
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestZeroDenominatorPolicy_UnitYield(t *testing.T) {
+	input := samplePeriodInputs()[0]
+	input.AggregateQ = NewOptionalFloat(0)
+	base, err := TemplateFor(KeyUnitYield)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := input.Calc(base, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := data[KeyUnitYield]; got != 0.0 {
+		t.Fatalf("default policy: unit_yield = %v, want 0", got)
+	}
+
+	data, err = input.Calc(base.WithZeroDenominatorPolicy(ZeroDenominatorNaN), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := data[KeyUnitYield].(float64); !ok || !math.IsNaN(got) {
+		t.Fatalf("NaN policy: unit_yield = %v, want NaN", data[KeyUnitYield])
+	}
+
+	// 舍入策略不得对 NaN 做十进制舍入。
+	rounded := base.WithZeroDenominatorPolicy(ZeroDenominatorNaN).WithRounding(RoundingPolicy{Mode: RoundHalfEven, Places: 2})
+	data, err = input.Calc(rounded, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := data[KeyUnitYield].(float64); !ok || !math.IsNaN(got) {
+		t.Fatalf("NaN policy with rounding: unit_yield = %v, want NaN", data[KeyUnitYield])
+	}
+
+	_, err = input.Calc(base.WithZeroDenominatorPolicy(ZeroDenominatorError), false)
+	if !errors.Is(err, ErrZeroDenominator) {
+		t.Fatalf("Error policy: expected ErrZeroDenominator, got %v", err)
+	}
+
+	// 分母非零时策略不影响结果。
+	normal := samplePeriodInputs()[0]
+	want, err := normal.Calc(base, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := normal.Calc(base.WithZeroDenominatorPolicy(ZeroDenominatorError), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[KeyUnitYield] != want[KeyUnitYield] {
+		t.Fatalf("unit_yield = %v, want %v", got[KeyUnitYield], want[KeyUnitYield])
+	}
+}
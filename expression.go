@@ -0,0 +1,289 @@
+package dynamicformula
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/force-c/dynamic-formula/utils"
+)
+
+// expressionDividePlaces 是表达式公式中除法保留的小数位数。
+const expressionDividePlaces = 16
+
+// expr 是编译后的四则运算表达式节点。
+type expr interface {
+	eval(prev map[string]interface{}) (float64, error)
+	// render 输出代入依赖取值后的表达式，如 base_cost(15.155) + settlement_impact(0.245)。
+	render(prev map[string]interface{}) string
+}
+
+type numberExpr struct {
+	value float64
+	text  string
+}
+
+func (e numberExpr) eval(map[string]interface{}) (float64, error) { return e.value, nil }
+
+func (e numberExpr) render(map[string]interface{}) string { return e.text }
+
+// refExpr 引用依赖结果，key 的写法同 ResultValue，可用 "节点名.Q/P/V" 读取输入节点分量。
+type refExpr struct {
+	key string
+}
+
+func (e refExpr) eval(prev map[string]interface{}) (float64, error) {
+	return ResultValue(prev, e.key)
+}
+
+func (e refExpr) render(prev map[string]interface{}) string {
+	value, err := ResultValue(prev, e.key)
+	if err != nil {
+		return e.key + "(?)"
+	}
+	return fmt.Sprintf("%s(%s)", e.key, utils.FormatDecimal(value, -1))
+}
+
+type negExpr struct {
+	operand expr
+}
+
+func (e negExpr) eval(prev map[string]interface{}) (float64, error) {
+	v, err := e.operand.eval(prev)
+	if err != nil {
+		return 0, err
+	}
+	return utils.DecimalSubtract(0, v), nil
+}
+
+func (e negExpr) render(prev map[string]interface{}) string {
+	return "-" + e.operand.render(prev)
+}
+
+type parenExpr struct {
+	inner expr
+}
+
+func (e parenExpr) eval(prev map[string]interface{}) (float64, error) { return e.inner.eval(prev) }
+
+func (e parenExpr) render(prev map[string]interface{}) string {
+	return "(" + e.inner.render(prev) + ")"
+}
+
+type binaryExpr struct {
+	op          byte
+	left, right expr
+}
+
+func (e binaryExpr) eval(prev map[string]interface{}) (float64, error) {
+	l, err := e.left.eval(prev)
+	if err != nil {
+		return 0, err
+	}
+	r, err := e.right.eval(prev)
+	if err != nil {
+		return 0, err
+	}
+	switch e.op {
+	case '+':
+		return utils.DecimalAdd(l, r), nil
+	case '-':
+		return utils.DecimalSubtract(l, r), nil
+	case '*':
+		return utils.DecimalMul(l, r), nil
+	default:
+		return utils.DecimalDivide(l, r, expressionDividePlaces), nil
+	}
+}
+
+func (e binaryExpr) render(prev map[string]interface{}) string {
+	return fmt.Sprintf("%s %c %s", e.left.render(prev), e.op, e.right.render(prev))
+}
+
+// ExpressionFormula 把 "base_cost + settlement_impact" 这类四则运算表达式编译为公式节点。
+// 标识符为依赖节点名，或 "节点名.Q/P/V" 形式的输入分量；依赖按首次出现的顺序声明。
+// 运算均使用十进制，除法保留 16 位小数，除数为零时按 utils.CurrentDivideByZeroMode() 处理。
+func ExpressionFormula(name, expression string) (FormulaNode, error) {
+	p := &exprParser{src: expression}
+	compiled, err := p.parse()
+	if err != nil {
+		return FormulaNode{}, fmt.Errorf("formula %s: %w", name, err)
+	}
+	return FormulaNode{
+		name:       name,
+		deps:       p.deps,
+		Expression: expression,
+		expr:       compiled,
+		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
+			return compiled.eval(prev)
+		},
+	}, nil
+}
+
+// exprParser 是四则运算表达式的递归下降解析器。
+type exprParser struct {
+	src  string
+	pos  int
+	deps []string
+}
+
+func (p *exprParser) parse() (expr, error) {
+	e, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return nil, fmt.Errorf("unexpected %q at offset %d in expression %q", p.src[p.pos], p.pos, p.src)
+	}
+	return e, nil
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+// peek 跳过空白并返回下一个字符，到达末尾时返回 0。
+func (p *exprParser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *exprParser) parseSum() (expr, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseProduct() (expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (expr, error) {
+	if p.peek() == '-' {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negExpr{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (expr, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, fmt.Errorf("unexpected end of expression %q", p.src)
+	case c == '(':
+		p.pos++
+		inner, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing ) at offset %d in expression %q", p.pos, p.src)
+		}
+		p.pos++
+		return parenExpr{inner: inner}, nil
+	case c >= '0' && c <= '9' || c == '.':
+		start := p.pos
+		for p.pos < len(p.src) && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		text := p.src[start:p.pos]
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q in expression %q", text, p.src)
+		}
+		return numberExpr{value: value, text: text}, nil
+	case c == '_' || unicode.IsLetter(rune(c)):
+		start := p.pos
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || p.src[p.pos] == '.' ||
+			unicode.IsLetter(rune(p.src[p.pos])) || unicode.IsDigit(rune(p.src[p.pos]))) {
+			p.pos++
+		}
+		key := p.src[start:p.pos]
+		dep, _, _ := strings.Cut(key, ".")
+		if !slices.Contains(p.deps, dep) {
+			p.deps = append(p.deps, dep)
+		}
+		return refExpr{key: key}, nil
+	default:
+		return nil, fmt.Errorf("unexpected %q at offset %d in expression %q", c, p.pos, p.src)
+	}
+}
+
+// CalcExplained 执行模板并为每个公式节点生成可审计的说明字符串。表达式公式输出代入依赖取值后的表达式，
+// 如 "total_cost = base_cost(15.155) + settlement_impact(0.245) = 15.4"；闭包公式无法还原表达式，
+// 尽力输出依赖取值，如 "net_margin = f(settlement_impact(0.245), scenario_margin(0.133)) = 0.112"。
+// 取值均为未经舍入策略处理的原始结果，被停用或跳过的节点不出现在结果中。
+func (m ContextInput) CalcExplained(t *CalcTemplate) (map[string]string, error) {
+	run, err := m.evaluate(t, CalcOptions{}, false)
+	if err != nil {
+		return nil, err
+	}
+	explained := make(map[string]string)
+	for _, name := range run.order {
+		n := t.registry[name]
+		if isInputNode(n) {
+			continue
+		}
+		value := explainValue(run.done[name])
+		if formula, ok := unwrapFormula(n); ok && formula.expr != nil {
+			explained[name] = fmt.Sprintf("%s = %s = %s", name, formula.expr.render(run.done), value)
+			continue
+		}
+		args := make([]string, 0, len(n.Requires()))
+		for _, dep := range n.Requires() {
+			if v, ok := run.done[dep]; ok {
+				args = append(args, fmt.Sprintf("%s(%s)", dep, explainValue(v)))
+			}
+		}
+		explained[name] = fmt.Sprintf("%s = f(%s) = %s", name, strings.Join(args, ", "), value)
+	}
+	run.release()
+	return explained, nil
+}
+
+// explainValue 格式化说明字符串中的取值，数值使用最短的精确形式。
+func explainValue(v interface{}) string {
+	switch value := v.(type) {
+	case float64:
+		return utils.FormatDecimal(value, -1)
+	case Result:
+		return formatCacheValue(value)
+	default:
+		return fmt.Sprintf("%v", value)
+	}
+}
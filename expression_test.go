@@ -0,0 +1,51 @@
+package dynamicformula
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpressionFormula(t *testing.T) {
+	n, err := ExpressionFormula("adjusted", "-(aggregate_metrics.Q - baseline_metrics.Q) * 2 / total_cost + 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDeps := []string{KeyAggregateMetrics, KeyBaselineMetrics, KeyTotalCost}
+	if !reflect.DeepEqual(n.Requires(), wantDeps) {
+		t.Fatalf("Requires() = %v, want %v", n.Requires(), wantDeps)
+	}
+	data, err := samplePeriodInputs()[0].Calc(NewCalcTemplate(n), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// -(0.8 - 0.2) × 2 / 15.4 + 1。
+	AssertResultClose(t, data, "adjusted", 0.922077922077922, 1e-12)
+
+	for _, bad := range []string{"", "base_cost +", "(base_cost", "base_cost $ 1", "1..2"} {
+		if _, err := ExpressionFormula("bad", bad); err == nil {
+			t.Errorf("expected error for expression %q", bad)
+		}
+	}
+}
+
+func TestContextInput_CalcExplained(t *testing.T) {
+	total, err := ExpressionFormula(KeyTotalCost, "base_cost + settlement_impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	net := currentRegistries().formulas[KeyNetMargin]
+	explained, err := samplePeriodInputs()[0].CalcExplained(NewCalcTemplate(total, net))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := explained[KeyTotalCost], "total_cost = base_cost(15.155) + settlement_impact(0.245) = 15.4"; got != want {
+		t.Fatalf("total_cost explanation = %q, want %q", got, want)
+	}
+	if got, want := explained[KeyNetMargin], "net_margin = f(settlement_impact(0.245), scenario_margin(0.133)) = 0.112"; got != want {
+		t.Fatalf("net_margin explanation = %q, want %q", got, want)
+	}
+	if _, ok := explained[KeyBaselineMetrics]; ok {
+		t.Fatal("input nodes must not be explained")
+	}
+}
@@ -0,0 +1,272 @@
+package dynamicformula
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/force-c/dynamic-formula/utils"
+)
+
+// fieldValue 以字符串形式读取 ContextInput 中的具名字段，缺失的可选值记为 <nil>。
+func (m ContextInput) fieldValue(name string) (string, error) {
+	v := reflect.ValueOf(m).FieldByName(name)
+	if !v.IsValid() {
+		return "", fmt.Errorf("unknown context field %q", name)
+	}
+	switch value := v.Interface().(type) {
+	case *OptionalFloat:
+		return formatOptional(value), nil
+	case int:
+		return strconv.Itoa(value), nil
+	default:
+		return fmt.Sprintf("%v", value), nil
+	}
+}
+
+// optionalField 按字段名读取 ContextInput 的可选数值字段。
+func (m ContextInput) optionalField(name string) (*OptionalFloat, error) {
+	v := reflect.ValueOf(m).FieldByName(name)
+	if !v.IsValid() {
+		return nil, fmt.Errorf("unknown context field %q", name)
+	}
+	value, ok := v.Interface().(*OptionalFloat)
+	if !ok {
+		return nil, fmt.Errorf("context field %q is not an optional float", name)
+	}
+	return value, nil
+}
+
+// ValidateTicks 校验具名价格字段是否落在对应的最小变动单位上，ticks 为字段名到 tick 的映射。
+// 缺失的字段跳过，所有不合规字段汇总为一个错误返回。
+func (m ContextInput) ValidateTicks(ticks map[string]float64) error {
+	names := make([]string, 0, len(ticks))
+	for name := range ticks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		value, err := m.optionalField(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if value == nil {
+			continue
+		}
+		ok, err := utils.IsOnTick(float64(*value), ticks[name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s value %v is not on tick %v", name, float64(*value), ticks[name]))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// optionalFloatFields 是 ContextInput 中所有 *OptionalFloat 字段的名称，按声明顺序排列。
+var optionalFloatFields = func() []string {
+	var names []string
+	typ := reflect.TypeOf(ContextInput{})
+	optional := reflect.TypeOf((*OptionalFloat)(nil))
+	for i := 0; i < typ.NumField(); i++ {
+		if typ.Field(i).Type == optional {
+			names = append(names, typ.Field(i).Name)
+		}
+	}
+	return names
+}()
+
+// RoundInputs 返回一个副本，其中每个非 nil 的可选数值字段都按 places 位小数做十进制舍入，nil 字段保持 nil，
+// NaN 与 ±Inf 无法舍入，保持原值。
+func (m ContextInput) RoundInputs(places int) ContextInput {
+	rounded := m
+	v := reflect.ValueOf(&rounded).Elem()
+	for _, name := range optionalFloatFields {
+		field := v.FieldByName(name)
+		value := field.Interface().(*OptionalFloat)
+		if value == nil {
+			continue
+		}
+		f := float64(*value)
+		if !math.IsNaN(f) && !math.IsInf(f, 0) {
+			f = utils.DecimalRound(f, places)
+		}
+		field.Set(reflect.ValueOf(NewOptionalFloat(f)))
+	}
+	return rounded
+}
+
+// setOptionalField 为具名可选数值字段写入一个新的指针，不修改原指针指向的值。
+func (m *ContextInput) setOptionalField(name string, value float64) error {
+	return m.setOptionalPointer(name, NewOptionalFloat(value))
+}
+
+// setOptionalPointer 将具名可选数值字段指向 value，value 为 nil 表示缺失。
+func (m *ContextInput) setOptionalPointer(name string, value *OptionalFloat) error {
+	field := reflect.ValueOf(m).Elem().FieldByName(name)
+	if !field.IsValid() {
+		return fmt.Errorf("unknown context field %q", name)
+	}
+	if field.Type() != reflect.TypeOf((*OptionalFloat)(nil)) {
+		return fmt.Errorf("context field %q is not an optional float", name)
+	}
+	field.Set(reflect.ValueOf(value))
+	return nil
+}
+
+// ParseOptionalFloat 解析来自 CSV/JSON 等外部来源的数值字符串：空串或纯空白返回 nil（缺失），
+// 合法数值返回对应指针，格式错误时返回错误。"NaN"、"Inf" 等非有限值同样视为格式错误。
+func ParseOptionalFloat(s string) (*OptionalFloat, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	return NewOptionalFloat(value), nil
+}
+
+// ParseContextField 按 ParseOptionalFloat 的规则解析 value 并写入 m 的具名可选数值字段。
+func ParseContextField(m *ContextInput, field, value string) error {
+	parsed, err := ParseOptionalFloat(value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", field, err)
+	}
+	return m.setOptionalPointer(field, parsed)
+}
+
+// PrecheckInputs 在计算前一次性检查模板中各公式声明的 InputFields，缺失的字段汇总到同一个错误中返回。
+func (t *CalcTemplate) PrecheckInputs(m ContextInput) error {
+	missing, err := t.missingInputFields(m)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required input fields: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// missingInputFields 按 ContextInput 字段声明顺序返回模板公式声明了 InputFields 但值为 nil 的字段。
+func (t *CalcTemplate) missingInputFields(m ContextInput) ([]string, error) {
+	required := make(map[string]bool)
+	for _, n := range t.registry {
+		if formula, ok := unwrapFormula(n); ok {
+			for _, field := range formula.InputFields {
+				required[field] = true
+			}
+		}
+	}
+
+	var missing []string
+	for _, field := range orderedContextFields(required) {
+		value, err := m.optionalField(field)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			missing = append(missing, field)
+		}
+	}
+	return missing, nil
+}
+
+// BatchIssue 描述批量输入中一条缺少必需字段的上下文。
+type BatchIssue struct {
+	Index         int
+	Period        int
+	MissingFields []string
+}
+
+// CheckBatch 不做计算，逐条检查 inputs 是否具备模板公式声明的 InputFields，只返回有问题的条目，
+// 便于调用方在批量计算前跳过或修正这些期次。模板声明了不存在的字段属于模板错误，由 PrecheckInputs 报告，此处不计入。
+func CheckBatch(t *CalcTemplate, inputs []ContextInput) []BatchIssue {
+	var issues []BatchIssue
+	for i, m := range inputs {
+		missing, err := t.missingInputFields(m)
+		if err != nil || len(missing) == 0 {
+			continue
+		}
+		issues = append(issues, BatchIssue{Index: i, Period: m.Period, MissingFields: missing})
+	}
+	return issues
+}
+
+// AddInputValidator 注册在每次计算开始前执行的输入校验，用于集中表达价格为正、数量非负等领域约束。
+func (t *CalcTemplate) AddInputValidator(v func(ContextInput) error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.validators = append(t.validators, v)
+}
+
+// inputValidators 返回已注册校验函数的副本。
+func (t *CalcTemplate) inputValidators() []func(ContextInput) error {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return append([]func(ContextInput) error(nil), t.validators...)
+}
+
+// validateInput 依次执行全部校验函数，并以 errors.Join 汇总失败结果。
+func (t *CalcTemplate) validateInput(m ContextInput) error {
+	var errs []error
+	for _, v := range t.inputValidators() {
+		if err := v(m); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// With 返回将具名可选数值字段设为 value 的副本，该字段使用新的指针，原上下文及其指针保持不变。
+func (m ContextInput) With(field string, value float64) (ContextInput, error) {
+	if err := m.setOptionalField(field, value); err != nil {
+		return ContextInput{}, err
+	}
+	return m, nil
+}
+
+// fillMissing 返回把所有缺失的可选数值字段设为 value 的副本。
+func (m ContextInput) fillMissing(value float64) ContextInput {
+	for _, name := range optionalFloatFields {
+		if current, _ := m.optionalField(name); current == nil {
+			_ = m.setOptionalField(name, value)
+		}
+	}
+	return m
+}
+
+// ResolveInputs 只执行模板依赖的输入节点，按节点名返回解析出的 Result，不运行任何公式，
+// 便于把数据问题与公式问题分开排查。
+func (m ContextInput) ResolveInputs(t *CalcTemplate) (map[string]Result, error) {
+	ordered, err := t.GetOrderedNodes()
+	if err != nil {
+		return nil, err
+	}
+	inputs := make(map[string]Result)
+	for _, n := range ordered {
+		if !isInputNode(n) {
+			continue
+		}
+		res, err := n.Compute(m, nil)
+		if err != nil {
+			return nil, &NodeComputeError{Node: n.Name(), Err: err}
+		}
+		r, ok := res.(Result)
+		if !ok {
+			return nil, fmt.Errorf("input node %s returned %T, want Result", n.Name(), res)
+		}
+		inputs[n.Name()] = r
+	}
+	return inputs, nil
+}
@@ -0,0 +1,233 @@
+package dynamicformula
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateTicks(t *testing.T) {
+	input := ContextInput{
+		ScenarioAP: NewOptionalFloat(18.55),
+		ScenarioBP: NewOptionalFloat(17.83),
+	}
+
+	if err := input.ValidateTicks(map[string]float64{"ScenarioAP": 0.05}); err != nil {
+		t.Fatalf("on-tick price rejected: %v", err)
+	}
+
+	err := input.ValidateTicks(map[string]float64{"ScenarioAP": 0.05, "ScenarioBP": 0.05})
+	if err == nil || !strings.Contains(err.Error(), "ScenarioBP") || strings.Contains(err.Error(), "ScenarioAP") {
+		t.Fatalf("expected only ScenarioBP to be off tick, got %v", err)
+	}
+
+	if err := input.ValidateTicks(map[string]float64{"ScenarioAP": -1}); err == nil {
+		t.Fatal("expected error for invalid tick")
+	}
+	if err := input.ValidateTicks(map[string]float64{"NoSuchField": 0.05}); err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+}
+
+func TestRoundInputs(t *testing.T) {
+	noisy := NewOptionalFloat(19.200000000000003)
+	input := ContextInput{
+		Period:    4,
+		ObservedP: noisy,
+		BaselineV: NewOptionalFloat(4.3),
+	}
+
+	rounded := input.RoundInputs(6)
+	if *rounded.ObservedP != 19.2 {
+		t.Errorf("ObservedP = %v, want 19.2", *rounded.ObservedP)
+	}
+	if *rounded.BaselineV != 4.3 {
+		t.Errorf("BaselineV = %v, want 4.3", *rounded.BaselineV)
+	}
+	if rounded.ObservedQ != nil {
+		t.Errorf("nil ObservedQ became %v", *rounded.ObservedQ)
+	}
+	if rounded.Period != 4 {
+		t.Errorf("Period = %d, want 4", rounded.Period)
+	}
+	if *input.ObservedP != 19.200000000000003 || rounded.ObservedP == noisy {
+		t.Error("RoundInputs must not modify or alias the original")
+	}
+
+	nonFinite := ContextInput{ObservedQ: NewOptionalFloat(math.NaN()), ObservedP: NewOptionalFloat(math.Inf(-1))}
+	rounded = nonFinite.RoundInputs(2)
+	if !math.IsNaN(float64(*rounded.ObservedQ)) || !math.IsInf(float64(*rounded.ObservedP), -1) {
+		t.Errorf("non-finite fields changed: Q=%v P=%v", *rounded.ObservedQ, *rounded.ObservedP)
+	}
+}
+
+func TestCalcTemplate_PrecheckInputs(t *testing.T) {
+	template := NewFullCalcTemplate()
+	input := samplePeriodInputs()[0]
+	if err := template.PrecheckInputs(input); err != nil {
+		t.Fatalf("complete input: %v", err)
+	}
+
+	input.ScenarioAP = nil
+	input.BaselineV = nil
+	err := template.PrecheckInputs(input)
+	if err == nil {
+		t.Fatal("expected missing fields error")
+	}
+	if want := "missing required input fields: BaselineV, ScenarioAP"; err.Error() != want {
+		t.Fatalf("error = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestContextInput_With(t *testing.T) {
+	original := samplePeriodInputs()[0]
+	originalPtr := original.ScenarioAP
+	originalValue := *original.ScenarioAP
+
+	changed, err := original.With("ScenarioAP", 99)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.ScenarioAP == nil || *changed.ScenarioAP != 99 {
+		t.Fatalf("changed.ScenarioAP = %v, want 99", formatOptional(changed.ScenarioAP))
+	}
+	if original.ScenarioAP != originalPtr || *originalPtr != originalValue {
+		t.Fatalf("original ScenarioAP modified: %v", formatOptional(original.ScenarioAP))
+	}
+	if changed.ScenarioAP == originalPtr {
+		t.Fatal("changed context must not alias the original pointer")
+	}
+
+	if _, err := original.With("NoSuchField", 1); err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+	if _, err := original.With("Period", 1); err == nil {
+		t.Fatal("expected error for non-optional field")
+	}
+}
+
+func TestCalcTemplate_AddInputValidator(t *testing.T) {
+	errPrice := errors.New("price must be positive")
+	template := NewFullCalcTemplate()
+	template.AddInputValidator(func(m ContextInput) error {
+		if m.ScenarioAP != nil && *m.ScenarioAP <= 0 {
+			return errPrice
+		}
+		return nil
+	})
+	template.AddInputValidator(func(m ContextInput) error {
+		if m.ScenarioAQ != nil && *m.ScenarioAQ < 0 {
+			return errors.New("quantity must be non-negative")
+		}
+		return nil
+	})
+
+	input := samplePeriodInputs()[0]
+	if _, err := input.Calc(template, false); err != nil {
+		t.Fatalf("valid input: %v", err)
+	}
+
+	input.ScenarioAP = NewOptionalFloat(-1)
+	input.ScenarioAQ = NewOptionalFloat(-2)
+	results, err := input.Calc(template, false)
+	if !errors.Is(err, errPrice) {
+		t.Fatalf("expected price validation error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "quantity must be non-negative") {
+		t.Fatalf("expected joined validation errors, got %v", err)
+	}
+	if results != nil {
+		t.Fatalf("expected no results, got %v", results)
+	}
+}
+
+func TestContextInput_ResolveInputs(t *testing.T) {
+	template := NewFullCalcTemplateWithOptions(FullTemplateOptions{IncludeOverhead: true})
+	input := samplePeriodInputs()[0]
+	inputs, err := input.ResolveInputs(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][3]float64{
+		KeyObservedMetrics:   {0.8, 19.2, 15.36},
+		KeyAggregateMetrics:  {0.8, 20.0, 16.0},
+		KeyBaselineMetrics:   {0.2, 21.5, 4.3},
+		KeyScenarioAInputs:   {0.25, 18.5, 4.625},
+		KeyScenarioBInputs:   {0.35, 17.8, 6.23},
+		KeyOverheadAdjusters: {0, 0, 0.8},
+	}
+	if len(inputs) != len(want) {
+		t.Fatalf("resolved %d inputs, want %d: %v", len(inputs), len(want), inputs)
+	}
+	for name, components := range want {
+		r, ok := inputs[name]
+		if !ok {
+			t.Fatalf("input %s not resolved", name)
+		}
+		for i, got := range []*OptionalFloat{r.Q, r.P, r.V} {
+			if got == nil || float64(*got) != components[i] {
+				t.Errorf("%s component %d = %v, want %v", name, i, formatOptional(got), components[i])
+			}
+		}
+	}
+}
+
+func TestParseOptionalFloat(t *testing.T) {
+	for _, s := range []string{"", "   ", "\t\n"} {
+		got, err := ParseOptionalFloat(s)
+		if err != nil || got != nil {
+			t.Fatalf("ParseOptionalFloat(%q) = %v, %v; want nil, nil", s, formatOptional(got), err)
+		}
+	}
+	got, err := ParseOptionalFloat(" 18.55 ")
+	if err != nil || got == nil || *got != 18.55 {
+		t.Fatalf("ParseOptionalFloat(\" 18.55 \") = %v, %v", formatOptional(got), err)
+	}
+	if _, err := ParseOptionalFloat("18,55"); err == nil {
+		t.Fatal("expected error for malformed number")
+	}
+	for _, s := range []string{"NaN", "Inf", "-Inf", "+infinity", "1e400"} {
+		if got, err := ParseOptionalFloat(s); err == nil {
+			t.Errorf("ParseOptionalFloat(%q) = %v, want error for non-finite value", s, formatOptional(got))
+		}
+	}
+}
+
+func TestParseContextField(t *testing.T) {
+	input := samplePeriodInputs()[0]
+	if err := ParseContextField(&input, "ScenarioAP", "21.5"); err != nil {
+		t.Fatal(err)
+	}
+	if input.ScenarioAP == nil || *input.ScenarioAP != 21.5 {
+		t.Fatalf("ScenarioAP = %v, want 21.5", formatOptional(input.ScenarioAP))
+	}
+	if err := ParseContextField(&input, "ScenarioAP", ""); err != nil || input.ScenarioAP != nil {
+		t.Fatalf("empty value: ScenarioAP = %v, err %v", formatOptional(input.ScenarioAP), err)
+	}
+
+	err := ParseContextField(&input, "ScenarioBP", "abc")
+	if err == nil || !strings.Contains(err.Error(), "ScenarioBP") {
+		t.Fatalf("expected malformed error naming the field, got %v", err)
+	}
+	if err := ParseContextField(&input, "Period", "3"); err == nil {
+		t.Fatal("expected error for non-optional field")
+	}
+	if err := ParseContextField(&input, "Unknown", "3"); err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+}
+
+func TestCheckBatch(t *testing.T) {
+	inputs := samplePeriodInputs()[:2]
+	inputs[1].ScenarioBV = nil
+	inputs[1].ObservedQ = nil
+
+	issues := CheckBatch(NewFullCalcTemplate(), inputs)
+	want := []BatchIssue{{Index: 1, Period: 2, MissingFields: []string{"ObservedQ", "ScenarioBV"}}}
+	if !reflect.DeepEqual(issues, want) {
+		t.Fatalf("CheckBatch = %+v, want %+v", issues, want)
+	}
+}
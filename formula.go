@@ -1,9 +1,15 @@
 package dynamicformula
 
 import (
+	"container/list"
+	"errors"
 	"fmt"
-	"reflect"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/force-c/dynamic-formula/utils"
@@ -25,6 +31,42 @@ type Result struct {
 	V *OptionalFloat
 }
 
+// EmptyResult 是三个分量全部缺失的结果，输入适配器返回它时通常意味着配置错误。
+var EmptyResult = Result{}
+
+// IsEmpty 报告结果是否三个分量全部缺失，用于区分全空的输入与缺失的节点。
+func (r Result) IsEmpty() bool {
+	return r.Q == nil && r.P == nil && r.V == nil
+}
+
+// Component 按分量名（Q/P/V）读取结果值。
+func (r Result) Component(component string) (*OptionalFloat, error) {
+	switch component {
+	case "Q":
+		return r.Q, nil
+	case "P":
+		return r.P, nil
+	case "V":
+		return r.V, nil
+	default:
+		return nil, fmt.Errorf("unknown result component %q", component)
+	}
+}
+
+// Overlay 以 r 为主叠加 other：r 中缺失的分量取自 other，r 已有的分量保留。
+func (r Result) Overlay(other Result) Result {
+	if r.Q == nil {
+		r.Q = other.Q
+	}
+	if r.P == nil {
+		r.P = other.P
+	}
+	if r.V == nil {
+		r.V = other.V
+	}
+	return r
+}
+
 // ContextInput 表示单次计算上下文，字段可按场景自由组合。
 type ContextInput struct {
 	Period int
@@ -52,6 +94,9 @@ type ContextInput struct {
 	OverheadQ *OptionalFloat
 	OverheadP *OptionalFloat
 	OverheadV *OptionalFloat
+
+	// Meta 携带非数值的上下文标注（如 "currency"），不参与公式计算。
+	Meta map[string]string `json:",omitempty"`
 }
 
 // Node 表示计算图中的节点。
@@ -64,9 +109,33 @@ type Node interface {
 // InputAdapter 将上下文数据转换为标准 Result 结果。
 type InputAdapter func(ContextInput) (q, p, v *OptionalFloat)
 
+// ChainAdapters 按顺序组合多个适配器，逐分量取第一个非 nil 的值，实现分层兜底。
+func ChainAdapters(adapters ...InputAdapter) InputAdapter {
+	return func(m ContextInput) (q, p, v *OptionalFloat) {
+		for _, adapter := range adapters {
+			if q != nil && p != nil && v != nil {
+				break
+			}
+			aq, ap, av := adapter(m)
+			if q == nil {
+				q = aq
+			}
+			if p == nil {
+				p = ap
+			}
+			if v == nil {
+				v = av
+			}
+		}
+		return q, p, v
+	}
+}
+
 type inputNode struct {
 	name    string
 	resolve InputAdapter
+	// id 是注册时分配的唯一标识，用于区分同名的新旧适配器，见 nextInputNodeID。
+	id uint64
 }
 
 func (n inputNode) Name() string { return n.name }
@@ -74,8 +143,54 @@ func (n inputNode) Name() string { return n.name }
 func (n inputNode) Requires() []string { return nil }
 
 func (n inputNode) Compute(m ContextInput, _ map[string]interface{}) (interface{}, error) {
-	q, p, v := n.resolve(m)
-	return Result{Q: q, P: p, V: v}, nil
+	return memoizedInput(n.name, n.id, m, func() (Result, error) {
+		q, p, v := n.resolve(m)
+		return Result{Q: q, P: p, V: v}, nil
+	})
+}
+
+// isInputNode 判断节点是否为输入节点，装饰器包装的节点按被包装的节点判断。
+func isInputNode(n Node) bool {
+	switch node := n.(type) {
+	case inputNode, lazyInputNode, intervalInputNode:
+		return true
+	case historyNode:
+		return isInputNode(node.Node)
+	default:
+		return false
+	}
+}
+
+// EvalNode 不构建模板，直接用已有的依赖值计算单个节点；deps 缺少任一必需依赖时返回错误。
+func EvalNode(n Node, m ContextInput, deps map[string]interface{}) (interface{}, error) {
+	var missing []string
+	for _, dep := range n.Requires() {
+		if _, ok := deps[dep]; !ok && !isOptionalDep(n, dep) {
+			missing = append(missing, dep)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing dependencies for node %s: %s", n.Name(), strings.Join(missing, ", "))
+	}
+	return n.Compute(m, deps)
+}
+
+// formulaOutput 由包内的公式类节点实现，标记其结果默认写入 Calc 输出。
+type formulaOutput interface {
+	formulaOutput()
+}
+
+// emitsByDefault 判断未设置 IncludeInputNodes 时节点结果是否写入输出：只输出公式类节点，
+// 装饰器按被包装的节点判断；输入节点与包外自定义的 Node 实现需开启 IncludeInputNodes 才输出。
+func emitsByDefault(n Node) bool {
+	switch node := n.(type) {
+	case historyNode:
+		return emitsByDefault(node.Node)
+	case formulaOutput:
+		return true
+	default:
+		return false
+	}
 }
 
 // FormulaNode 代表执行自定义公式的计算节点。
@@ -83,86 +198,449 @@ type FormulaNode struct {
 	name    string
 	deps    []string
 	formula func(ContextInput, map[string]interface{}) (float64, error)
+	branch  func(ContextInput, map[string]interface{}) string
+	// withPresence 由 OptionalFormulaNode 设置，额外接收可选依赖的存在标记。
+	withPresence func(ContextInput, map[string]interface{}, map[string]bool) (float64, error)
+
+	// InputFields 声明公式直接读取的 ContextInput 字段，节点级缓存据此生成缓存键。
+	InputFields []string
+	// Unit 声明公式输出的量纲，供 CheckUnits 做静态检查，可为空。
+	Unit string
+	// Version 是公式版本号（如 "v2"），由 RegisterFormulaVersion 注册为 name@version。
+	Version string
+	// Tolerance 是比较该节点结果时允许的绝对误差，0 表示十进制精确相等，见 ResultsEqualWithin。
+	Tolerance float64
+	// OptionalDeps 声明可缺省的依赖：无法解析、被停用或结果为空时不报错，公式在 prev 中看不到该键。
+	OptionalDeps []string
+	// Tags 是节点的分类标签（如 cost、margin、yield），供 NodesWithTag 与 CalcOptions.EmitTags 过滤结果。
+	Tags []string
+	// Expression 是由 ExpressionFormula 编译的源表达式，闭包公式为空。
+	Expression string
+	// expr 是 Expression 编译后的语法树，供 CalcExplained 代入取值。
+	expr expr
 }
 
 func (n FormulaNode) Name() string { return n.name }
 
-func (n FormulaNode) Requires() []string { return n.deps }
+func (FormulaNode) formulaOutput() {}
+
+// IsValid 校验公式节点具备名称与计算函数。
+func (n FormulaNode) IsValid() error {
+	if n.name == "" {
+		return fmt.Errorf("formula has no name")
+	}
+	if n.formula == nil && n.withPresence == nil {
+		return fmt.Errorf("formula %s has no computation function", n.name)
+	}
+	return nil
+}
+
+// Requires 返回必需依赖与可选依赖。
+func (n FormulaNode) Requires() []string {
+	if len(n.OptionalDeps) == 0 {
+		return n.deps
+	}
+	deps := make([]string, 0, len(n.deps)+len(n.OptionalDeps))
+	deps = append(deps, n.deps...)
+	return append(deps, n.OptionalDeps...)
+}
 
 func (n FormulaNode) Compute(m ContextInput, done map[string]interface{}) (interface{}, error) {
-	return n.formula(m, done)
+	if n.withPresence != nil {
+		view, present := n.optionalView(done)
+		return n.withPresence(m, view, present)
+	}
+	if len(n.OptionalDeps) == 0 {
+		return n.formula(m, done)
+	}
+	view, _ := n.optionalView(done)
+	return n.formula(m, view)
+}
+
+// optionalView 返回去掉缺失可选依赖后的结果视图，以及每个可选依赖是否存在的标记。
+func (n FormulaNode) optionalView(done map[string]interface{}) (map[string]interface{}, map[string]bool) {
+	present := make(map[string]bool, len(n.OptionalDeps))
+	view := make(map[string]interface{}, len(done))
+	for k, v := range done {
+		view[k] = v
+	}
+	for _, dep := range n.OptionalDeps {
+		if isAbsentValue(view[dep]) {
+			delete(view, dep)
+			continue
+		}
+		present[dep] = true
+	}
+	return view, present
+}
+
+// isOptionalDep 判断 dep 是否为节点声明的可选依赖。
+func isOptionalDep(n Node, dep string) bool {
+	formula, ok := unwrapFormula(n)
+	if !ok {
+		return false
+	}
+	for _, name := range formula.OptionalDeps {
+		if name == dep {
+			return true
+		}
+	}
+	return false
+}
+
+// isAbsentValue 判断依赖结果是否视为缺失：未计算、为 nil 或各分量均为空的 Result。
+func isAbsentValue(v interface{}) bool {
+	switch value := v.(type) {
+	case nil:
+		return true
+	case Result:
+		return value.Q == nil && value.P == nil && value.V == nil
+	default:
+		return false
+	}
+}
+
+// OptionalFormulaNode 构造带可选依赖的公式节点，fn 的 present 标记每个可选依赖是否可用。
+func OptionalFormulaNode(name string, deps, optional []string, fn func(m ContextInput, prev map[string]interface{}, present map[string]bool) (float64, error)) FormulaNode {
+	return FormulaNode{
+		name:         name,
+		deps:         deps,
+		OptionalDeps: optional,
+		withPresence: fn,
+	}
+}
+
+// Branch 返回公式在当前输入下命中的分支标识，无分支的公式返回空串。
+func (n FormulaNode) Branch(m ContextInput, done map[string]interface{}) string {
+	if n.branch == nil {
+		return ""
+	}
+	return n.branch(m, done)
+}
+
+// brancher 由带条件分支的节点实现，供报告记录分支走向。
+type brancher interface {
+	Branch(ContextInput, map[string]interface{}) string
 }
 
 // CalcTemplate 保存选定节点与依赖关系。
 type CalcTemplate struct {
 	nodes    []Node
 	registry map[string]Node
+	resolver Resolver
+
+	// snapshot 是构建模板时捕获的全局注册表快照，保证模板内的依赖来自同一版本。
+	snapshot *registrySnapshot
+
+	// priorities 在拓扑约束内调整同时就绪节点的执行先后，见 WithPriority。
+	priorities map[string]int
+	// rounding 是输出结果的舍入策略，见 WithRounding。
+	rounding RoundingPolicy
+	// params 是公式可读取的常量参数，见 WithParams。
+	params map[string]float64
+	// zeroDenominator 是比值公式分母为零时的策略，见 WithZeroDenominatorPolicy。
+	zeroDenominator ZeroDenominatorPolicy
+
+	mutex      sync.RWMutex
+	disabled   map[string]bool
+	validators []func(ContextInput) error
+	invariants []invariant
 }
 
-// NewCalcTemplate 根据传入节点收集依赖。
+// Disable 在运行时停用节点：Calc 会跳过它，结果中不再出现该键。
+// 依赖它的节点默认报 ErrDependencyDisabled，开启 CalcOptions.SkipDisabledDependents 时一并跳过。
+func (t *CalcTemplate) Disable(name string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.disabled == nil {
+		t.disabled = make(map[string]bool)
+	}
+	t.disabled[name] = true
+}
+
+// Enable 重新启用被 Disable 停用的节点。
+func (t *CalcTemplate) Enable(name string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.disabled, name)
+}
+
+// disabledSnapshot 返回当前停用节点集合的副本，保证单次 Calc 内视图一致。
+func (t *CalcTemplate) disabledSnapshot() map[string]bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	snapshot := make(map[string]bool, len(t.disabled))
+	for name := range t.disabled {
+		snapshot[name] = true
+	}
+	return snapshot
+}
+
+// ErrDependencyDisabled 表示节点的某个依赖已被停用或跳过。
+var ErrDependencyDisabled = errors.New("dependency disabled")
+
+// Resolver 按名称解析依赖节点，可替代全局注册表实现依赖注入。
+type Resolver interface {
+	Lookup(name string) (Node, bool)
+}
+
+// MapResolver 是基于内存映射的 Resolver。
+type MapResolver map[string]Node
+
+// Lookup 实现 Resolver。
+func (r MapResolver) Lookup(name string) (Node, bool) {
+	node, ok := r[name]
+	return node, ok
+}
+
+// NewCalcTemplate 根据传入节点收集依赖，传入节点优先于全局注册表中的同名节点。
 func NewCalcTemplate(nodes ...Node) *CalcTemplate {
+	return NewCalcTemplateWith(nil, nodes...)
+}
+
+// NewCalcTemplateWith 使用指定的 Resolver 解析依赖，resolver 为 nil 时回退到全局注册表。
+func NewCalcTemplateWith(resolver Resolver, nodes ...Node) *CalcTemplate {
+	return newCalcTemplate(currentRegistries(), resolver, nodes...)
+}
+
+// NewCalcTemplateChecked 与 NewCalcTemplate 相同，但在构建期校验节点：缺少计算函数的公式
+// 与无法解析的依赖以错误返回，而不是在 Calc 中途 panic。
+func NewCalcTemplateChecked(nodes ...Node) (t *CalcTemplate, err error) {
+	for _, n := range nodes {
+		if err := validateNode(n); err != nil {
+			return nil, err
+		}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			msg, ok := r.(string)
+			if !ok || !strings.HasPrefix(msg, "unknown dependency: ") {
+				panic(r)
+			}
+			t, err = nil, errors.New(msg)
+		}
+	}()
+	t = NewCalcTemplate(nodes...)
+	for _, n := range t.registry {
+		if err := validateNode(n); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// validateNode 校验节点（含装饰器包装的公式节点）是否可执行。
+func validateNode(n Node) error {
+	if formula, ok := unwrapFormula(n); ok {
+		return formula.IsValid()
+	}
+	return nil
+}
+
+// newCalcTemplate 基于指定的注册表快照构建模板。
+func newCalcTemplate(snapshot *registrySnapshot, resolver Resolver, nodes ...Node) *CalcTemplate {
 	t := &CalcTemplate{
 		nodes:    nodes,
 		registry: make(map[string]Node),
+		resolver: resolver,
+		snapshot: snapshot,
 	}
-
-	required := make(map[string]bool)
 	for _, n := range nodes {
-		collectDependencies(n, required)
 		t.registry[n.Name()] = n
 	}
 
-	for name := range required {
-		if node, ok := inputRegistry[name]; ok {
-			t.registry[name] = node
-		} else if node, ok := formulaRegistry[name]; ok {
-			t.registry[name] = node
-		} else {
-			panic("unknown dependency: " + name)
-		}
+	required := make(map[string]bool)
+	for _, n := range nodes {
+		t.collectDependencies(n, required)
 	}
 
 	return t
 }
 
-// collectDependencies 递归遍历依赖图。
-func collectDependencies(n Node, required map[string]bool) {
+// collectDependencies 递归遍历依赖图，并把解析到的依赖写入模板注册表。
+func (t *CalcTemplate) collectDependencies(n Node, required map[string]bool) {
 	if required[n.Name()] {
 		return
 	}
 	required[n.Name()] = true
 	for _, dep := range n.Requires() {
-		if node, ok := inputRegistry[dep]; ok {
-			collectDependencies(node, required)
-		} else if node, ok := formulaRegistry[dep]; ok {
-			collectDependencies(node, required)
-		} else {
+		node, ok := t.registry[dep]
+		if !ok {
+			node, ok = t.lookup(dep)
+		}
+		if !ok {
+			if isOptionalDep(n, dep) {
+				continue
+			}
 			panic("unknown dependency: " + dep)
 		}
+		t.registry[dep] = node
+		t.collectDependencies(node, required)
+	}
+}
+
+// depsOf 返回节点在本模板中实际生效的依赖，未能解析的可选依赖被剔除。
+func (t *CalcTemplate) depsOf(n Node) []string {
+	deps := n.Requires()
+	filtered := deps[:0:0]
+	for _, dep := range deps {
+		if _, ok := t.registry[dep]; !ok && isOptionalDep(n, dep) {
+			continue
+		}
+		filtered = append(filtered, dep)
+	}
+	return filtered
+}
+
+// lookup 通过模板的 Resolver 解析节点，未设置时查找全局注册表。
+func (t *CalcTemplate) lookup(name string) (Node, bool) {
+	if t.resolver != nil {
+		return t.resolver.Lookup(name)
 	}
+	return t.snapshot.lookup(name)
+}
+
+// lookupRegistered 在当前的全局注册表中查找节点。
+func lookupRegistered(name string) (Node, bool) {
+	return currentRegistries().lookup(name)
 }
 
 // NewFullCalcTemplate 返回包含所有默认公式的模板。
 func NewFullCalcTemplate() *CalcTemplate {
-	return NewCalcTemplate(
-		formulaRegistry[KeyBaseCost],
-		formulaRegistry[KeySettlementImpact],
-		formulaRegistry[KeyScenarioMargin],
-		formulaRegistry[KeyTotalCost],
-		formulaRegistry[KeyNetMargin],
-		formulaRegistry[KeyUnitYield],
-	)
+	return NewFullCalcTemplateWithOptions(FullTemplateOptions{})
 }
 
-// GetOrderedNodes 以依赖顺序返回节点。
+// FullTemplateOptions 控制完整模板中可选公式的开关。
+type FullTemplateOptions struct {
+	// IncludeOverhead 为 true 时加入 overhead_total。
+	IncludeOverhead bool
+	// IncludeElasticSettlement 为 true 时加入 settlement_impact_elastic。
+	IncludeElasticSettlement bool
+	// IncludeAdjustedTotalCost 为 true 时加入 adjusted_total_cost 及其依赖的 overhead_total。
+	IncludeAdjustedTotalCost bool
+	// IncludeSeasonalBaseCost 为 true 时加入 seasonal_base_cost。
+	IncludeSeasonalBaseCost bool
+}
+
+// NewFullCalcTemplateWithOptions 返回包含所有默认公式及按需开启的可选公式的模板。
+// 任一所需公式未注册时 panic，需要错误返回值时使用 NewFullCalcTemplateCheckedWithOptions。
+func NewFullCalcTemplateWithOptions(opts FullTemplateOptions) *CalcTemplate {
+	t, err := NewFullCalcTemplateCheckedWithOptions(opts)
+	if err != nil {
+		panic(err.Error())
+	}
+	return t
+}
+
+// NewFullCalcTemplateChecked 同 NewFullCalcTemplate，但在内置公式缺失时返回错误而不是 panic。
+func NewFullCalcTemplateChecked() (*CalcTemplate, error) {
+	return NewFullCalcTemplateCheckedWithOptions(FullTemplateOptions{})
+}
+
+// NewFullCalcTemplateCheckedWithOptions 同 NewFullCalcTemplateWithOptions，错误中列出所有未注册的公式。
+func NewFullCalcTemplateCheckedWithOptions(opts FullTemplateOptions) (*CalcTemplate, error) {
+	keys := []string{KeyBaseCost, KeySettlementImpact, KeyScenarioMargin, KeyTotalCost, KeyNetMargin, KeyUnitYield}
+	if opts.IncludeOverhead || opts.IncludeAdjustedTotalCost {
+		keys = append(keys, KeyOverheadTotal)
+	}
+	if opts.IncludeElasticSettlement {
+		keys = append(keys, KeySettlementImpactElastic)
+	}
+	if opts.IncludeAdjustedTotalCost {
+		keys = append(keys, KeyAdjustedTotalCost)
+	}
+	if opts.IncludeSeasonalBaseCost {
+		keys = append(keys, KeySeasonalBaseCost)
+	}
+	snapshot := currentRegistries()
+	nodes, err := snapshot.builtinFormulas(keys)
+	if err != nil {
+		return nil, fmt.Errorf("full template: %w", err)
+	}
+	t := newCalcTemplate(snapshot, nil, nodes...)
+	t.AddInvariant(InvariantTotalCostSum, checkTotalCostSum)
+	return t, nil
+}
+
+// builtinFormulas 按顺序取出 keys 对应的公式节点，错误中列出所有未注册的公式。
+func (s *registrySnapshot) builtinFormulas(keys []string) ([]Node, error) {
+	nodes := make([]Node, 0, len(keys))
+	var missing []string
+	for _, key := range keys {
+		node, ok := s.formulas[key]
+		if !ok || node == nil {
+			missing = append(missing, key)
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("built-in formulas not registered: %s", strings.Join(missing, ", "))
+	}
+	return nodes, nil
+}
+
+// NewPricingTemplate 返回定价相关公式的模板，blended_price 未注册时 panic。
+func NewPricingTemplate() *CalcTemplate {
+	t, err := NewPricingTemplateChecked()
+	if err != nil {
+		panic(err.Error())
+	}
+	return t
+}
+
+// NewPricingTemplateChecked 同 NewPricingTemplate，但在内置公式缺失时返回错误而不是 panic。
+func NewPricingTemplateChecked() (*CalcTemplate, error) {
+	snapshot := currentRegistries()
+	nodes, err := snapshot.builtinFormulas([]string{KeyBlendedPrice})
+	if err != nil {
+		return nil, fmt.Errorf("pricing template: %w", err)
+	}
+	return newCalcTemplate(snapshot, nil, nodes...), nil
+}
+
+// TemplateFor 按输出名从全局公式注册表中取节点并构建模板，未知名称返回错误。
+func TemplateFor(outputs ...string) (*CalcTemplate, error) {
+	if len(outputs) == 0 {
+		return nil, fmt.Errorf("no outputs requested")
+	}
+	nodes := make([]Node, 0, len(outputs))
+	snapshot := currentRegistries()
+	for _, name := range outputs {
+		node, ok := snapshot.formulas[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown formula %s", name)
+		}
+		nodes = append(nodes, node)
+	}
+	return newCalcTemplate(snapshot, nil, nodes...), nil
+}
+
+// GetOrderedNodes 以依赖顺序返回节点，设置了优先级时在依赖约束内按优先级重排。
 func (t *CalcTemplate) GetOrderedNodes() ([]Node, error) {
+	ordered, err := t.topologicalOrder()
+	if err != nil || len(t.priorities) == 0 {
+		return ordered, err
+	}
+	return t.prioritize(ordered), nil
+}
+
+// topologicalOrder 以依赖顺序返回节点，全局注册表模板共享排序缓存。
+func (t *CalcTemplate) topologicalOrder() ([]Node, error) {
 	cacheKey := ""
 	for _, n := range t.nodes {
 		cacheKey += n.Name() + ";"
 	}
 
-	if cached, ok := sortCache.Get(cacheKey); ok {
-		return cached.([]Node), nil
+	// 自定义 Resolver 下同名节点的依赖关系可能不同，因此只有全局注册表模板共享排序缓存。
+	useCache := t.resolver == nil
+	if cached, ok := sortCache.Get(cacheKey); ok && useCache {
+		entry := cached.(sortCacheEntry)
+		if entry.generation == t.snapshot.generation {
+			if ordered, ok := t.resolveOrder(entry.names); ok && t.satisfiesDeps(ordered) {
+				return ordered, nil
+			}
+		}
 	}
 
 	visited := make(map[string]bool)
@@ -178,13 +656,11 @@ func (t *CalcTemplate) GetOrderedNodes() ([]Node, error) {
 			return nil
 		}
 		temp[n.Name()] = true
-		for _, dep := range n.Requires() {
+		for _, dep := range t.depsOf(n) {
 			var next Node
 			if node, ok := t.registry[dep]; ok {
 				next = node
-			} else if node, ok := formulaRegistry[dep]; ok {
-				next = node
-			} else if node, ok := inputRegistry[dep]; ok {
+			} else if node, ok := t.lookup(dep); ok {
 				next = node
 			} else {
 				return fmt.Errorf("node %s not found", dep)
@@ -207,86 +683,570 @@ func (t *CalcTemplate) GetOrderedNodes() ([]Node, error) {
 		}
 	}
 
-	sortCache.Set(cacheKey, result, time.Hour)
+	if useCache {
+		names := make([]string, len(result))
+		for i, n := range result {
+			names[i] = n.Name()
+		}
+		sortCache.Set(cacheKey, sortCacheEntry{generation: t.snapshot.generation, names: names}, time.Hour)
+	}
 	return result, nil
 }
 
+// sortCacheCapacity 是排序缓存的条目上限，防止不同模板签名无限累积。
+const sortCacheCapacity = 1024
+
+// sortCacheEntry 记录排序结果及其所基于的注册表版本，注册表替换后旧排序自动失效。
+type sortCacheEntry struct {
+	generation uint64
+	names      []string
+}
+
+// satisfiesDeps 确认缓存的顺序仍满足本模板当前的依赖边：同名模板可能持有依赖关系不同的节点，
+// 此时不能沿用缓存，需要重新排序（并检测可能出现的环）。
+func (t *CalcTemplate) satisfiesDeps(ordered []Node) bool {
+	position := make(map[string]int, len(ordered))
+	for i, n := range ordered {
+		position[n.Name()] = i
+	}
+	for i, n := range ordered {
+		for _, dep := range t.depsOf(n) {
+			if j, ok := position[dep]; !ok || j >= i {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// resolveOrder 将缓存的节点名顺序映射回本模板自身的节点，避免复用其他同名模板的节点实例。
+func (t *CalcTemplate) resolveOrder(names []string) ([]Node, bool) {
+	ordered := make([]Node, len(names))
+	for i, name := range names {
+		node, ok := t.registry[name]
+		if !ok {
+			return nil, false
+		}
+		ordered[i] = node
+	}
+	return ordered, true
+}
+
+// CalcOptions 控制单次计算的行为，零值即默认行为。
+type CalcOptions struct {
+	// IncludeInputNodes 为 true 时结果中同时包含输入节点。
+	IncludeInputNodes bool
+	// RejectNonFinite 为 true 时，公式产出 NaN/Inf 会直接报错而不是继续向下游传播。
+	RejectNonFinite bool
+	// NodeCache 非空时缓存公式节点的输出，缓存键仅由节点声明的 InputFields 与依赖结果构成，
+	// 因此直接读取 ContextInput 的公式必须完整声明 InputFields。
+	NodeCache *TTLCache
+	// NodeCacheTTL 为节点缓存的有效期，零值时使用 DefaultNodeCacheTTL。
+	NodeCacheTTL time.Duration
+	// EmitOnly 非空时结果只保留列出的节点（含输入节点），其余节点照常计算但不输出。
+	EmitOnly []string
+	// SkipDisabledDependents 为 true 时，依赖被停用节点的节点也被跳过而不是报错。
+	SkipDisabledDependents bool
+	// TotalBudget 大于 0 时限制整次计算的墙钟时间：若已耗时加上此前最慢节点的耗时将超出预算，
+	// 则在开始下一个节点前中止并返回 ErrBudgetExceeded。
+	TotalBudget time.Duration
+	// MissingAsNaN 为 true 时，缺失的可选输入字段按 NaN 参与计算，不再触发空值校验错误；
+	// NaN 沿公式自然传播，数据不完整的结果以 NaN 出现在结果中。
+	MissingAsNaN bool
+	// StrictDeps 为 true 时校验每个公式节点只读取了声明的依赖，违反时返回 ErrUndeclaredDependency。
+	// 校验需要以受限视图重算节点，仅建议在测试与排查时开启。
+	StrictDeps bool
+	// EmitTags 非空时结果只保留带有其中任一标签的公式节点；与 EmitOnly 同时设置时两者都须满足。
+	EmitTags []string
+	// RejectEmptyInputs 为 true 时，输入节点产出 EmptyResult 会返回 ErrEmptyInput，用于发现配置错误的适配器。
+	RejectEmptyInputs bool
+
+	// templates 是外层模板的结构哈希栈，由子模板节点传入，用于检测递归嵌套。
+	templates []string
+	// tolerateFailures 由 CalcWithStatus 设置：容错公式失败时跳过节点而不是返回错误。
+	tolerateFailures bool
+}
+
+// ResultFormatPlaces 是 Calc 输出 Result 字符串时各分量的小数位数，经 utils.FormatDecimal 格式化：
+// 默认 -1 输出去掉二进制噪声的最短形式（同 utils.FormatFloat）；设为 2 时输出形如 "{10.00, <nil>, 5.00}"；
+// 需要保留超过 15 位有效数字时设为 utils.PlacesExact。
+var ResultFormatPlaces = -1
+
+// ErrEmptyInput 表示开启 CalcOptions.RejectEmptyInputs 时输入节点的 Q/P/V 全部缺失。
+var ErrEmptyInput = errors.New("empty input result")
+
+// ErrBudgetExceeded 表示计算因超出 CalcOptions.TotalBudget 而中止。
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// DefaultNodeCacheTTL 是节点级缓存的默认有效期。
+const DefaultNodeCacheTTL = 10 * time.Minute
+
 // Calc 在给定上下文中执行模板。
 func (m ContextInput) Calc(t *CalcTemplate, includeInputNodes bool) (map[string]interface{}, error) {
+	return m.CalcWithOptions(t, CalcOptions{IncludeInputNodes: includeInputNodes})
+}
+
+// CalcWithOptions 按指定选项在给定上下文中执行模板。
+func (m ContextInput) CalcWithOptions(t *CalcTemplate, opts CalcOptions) (map[string]interface{}, error) {
+	run, err := m.evaluate(t, opts, false)
+	if err != nil {
+		return nil, err
+	}
+	results := run.results
+	run.release()
+	return results, nil
+}
+
+// TemplateSelector 根据上下文在运行时选择模板，例如按地区或期次使用不同公式。
+type TemplateSelector func(ContextInput) *CalcTemplate
+
+// CalcSelected 用 sel 为 m 选择模板并按 opts 执行；选择器返回 nil 时报错。
+func CalcSelected(sel TemplateSelector, m ContextInput, opts CalcOptions) (map[string]interface{}, error) {
+	t := sel(m)
+	if t == nil {
+		return nil, fmt.Errorf("no template selected for period %d", m.Period)
+	}
+	return m.CalcWithOptions(t, opts)
+}
+
+// calcRun 记录单次计算的产物，trace 开启时额外记录耗时与分支。
+type calcRun struct {
+	done     map[string]interface{}
+	results  map[string]interface{}
+	timings  map[string]time.Duration
+	branches map[string]string
+	skipped  []string
+	statuses map[string]Status
+	order    []string
+}
+
+// runPool 复用 calcRun 及其 done、statuses 与 order，降低批量计算时的分配与 GC 压力。
+// results 每次新建，不会被池化后泄漏给调用方。
+var runPool = sync.Pool{
+	New: func() interface{} {
+		return &calcRun{
+			done:     make(map[string]interface{}),
+			statuses: make(map[string]Status),
+		}
+	},
+}
+
+// release 清空 run 并归还到池中，调用后不得再读取 run 的任何字段。
+// 只有确认 done、statuses 与 order 不会被返回给调用方时才能调用。
+func (run *calcRun) release() {
+	clear(run.done)
+	clear(run.statuses)
+	run.order = run.order[:0]
+	run.results = nil
+	run.timings = nil
+	run.branches = nil
+	run.skipped = nil
+	runPool.Put(run)
+}
+
+// evaluate 是 Calc 系列接口共用的执行核心。
+func (m ContextInput) evaluate(t *CalcTemplate, opts CalcOptions, trace bool) (*calcRun, error) {
+	if opts.MissingAsNaN {
+		m = m.fillMissing(math.NaN())
+	}
 	ordered, err := t.GetOrderedNodes()
 	if err != nil {
 		return nil, err
 	}
-	done := make(map[string]interface{}, len(ordered))
-	results := make(map[string]interface{})
+	templates, err := t.enterTemplate(opts.templates)
+	if err != nil {
+		return nil, err
+	}
+	run := runPool.Get().(*calcRun)
+	run.results = make(map[string]interface{}, len(ordered))
+	if trace {
+		run.timings = make(map[string]time.Duration, len(ordered))
+		run.branches = make(map[string]string)
+	}
+	done := run.done
+	if len(t.params) > 0 {
+		done[paramsKey] = t.params
+	}
+	if t.zeroDenominator != ZeroDenominatorZero {
+		done[zeroDenominatorKey] = t.zeroDenominator
+	}
+	if templates != nil {
+		done[templateStackKey] = templates
+	}
+
+	var emitOnly map[string]bool
+	if len(opts.EmitOnly) > 0 {
+		emitOnly = make(map[string]bool, len(opts.EmitOnly))
+		for _, name := range opts.EmitOnly {
+			if _, ok := t.registry[name]; !ok {
+				return nil, fmt.Errorf("emit-only node %s is not part of the template", name)
+			}
+			emitOnly[name] = true
+		}
+	}
+
+	if err := t.validateInput(m); err != nil {
+		return nil, err
+	}
+
+	disabled := t.disabledSnapshot()
+	timed := trace || opts.TotalBudget > 0
+	begin := time.Now()
+	var lastNode string
+	var slowest time.Duration
 	for _, n := range ordered {
-		res, err := n.Compute(m, done)
-		if err != nil {
-			return nil, fmt.Errorf("node %s compute failed: %w", n.Name(), err)
+		if disabled[n.Name()] {
+			run.skipped = append(run.skipped, n.Name())
+			continue
+		}
+		if dep := firstSkippedDependency(n, disabled, run.skipped); dep != "" {
+			if opts.SkipDisabledDependents {
+				run.skipped = append(run.skipped, n.Name())
+				continue
+			}
+			return nil, &NodeComputeError{
+				Node: n.Name(),
+				Path: executionPath(ordered, n.Name(), t.registry),
+				Err:  fmt.Errorf("%w: %s", ErrDependencyDisabled, dep),
+			}
+		}
+
+		if opts.TotalBudget > 0 && lastNode != "" {
+			if elapsed := time.Since(begin); elapsed+slowest > opts.TotalBudget {
+				return nil, fmt.Errorf("%w after node %s: %v elapsed of %v", ErrBudgetExceeded, lastNode, elapsed, opts.TotalBudget)
+			}
+		}
+
+		var started time.Time
+		if timed {
+			started = time.Now()
+		}
+		var res interface{}
+		if sc, ok := n.(statusComputer); ok {
+			status := sc.computeStatus(m, done, run.statuses)
+			run.statuses[n.Name()] = status.Status
+			if status.Status == StatusFailed {
+				if !opts.tolerateFailures {
+					return nil, &NodeComputeError{
+						Node: n.Name(),
+						Path: executionPath(ordered, n.Name(), t.registry),
+						Err:  fmt.Errorf("status formula %s failed: %s", n.Name(), status.Note),
+					}
+				}
+				continue
+			}
+			res = status.Value
+		} else {
+			upstream := worstStatus(t.depsOf(n), run.statuses)
+			if upstream == StatusFailed {
+				run.statuses[n.Name()] = StatusFailed
+				continue
+			}
+			res, err = m.computeNode(n, done, opts)
+			if err == nil && opts.StrictDeps && !isInputNode(n) {
+				err = m.checkDeclaredDeps(n, done, res)
+			}
+			if err == nil && opts.RejectEmptyInputs && isInputNode(n) {
+				if r, ok := res.(Result); ok && r.IsEmpty() {
+					err = fmt.Errorf("%w: input %s has no Q, P or V", ErrEmptyInput, n.Name())
+				}
+			}
+			if err != nil {
+				return nil, &NodeComputeError{Node: n.Name(), Path: executionPath(ordered, n.Name(), t.registry), Err: err}
+			}
+			if !isInputNode(n) {
+				run.statuses[n.Name()] = upstream
+			}
+		}
+		if timed {
+			elapsed := time.Since(started)
+			if elapsed > slowest {
+				slowest = elapsed
+			}
+			lastNode = n.Name()
+			if trace {
+				run.timings[n.Name()] = elapsed
+			}
+		}
+		if trace {
+			if b, ok := n.(brancher); ok {
+				if branch := b.Branch(m, done); branch != "" {
+					run.branches[n.Name()] = branch
+				}
+			}
+		}
+		if opts.RejectNonFinite {
+			if f, ok := res.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+				return nil, fmt.Errorf("node %s produced non-finite result", n.Name())
+			}
 		}
 		done[n.Name()] = res
-		if includeInputNodes || reflect.TypeOf(n) == reflect.TypeOf(FormulaNode{}) {
+		run.order = append(run.order, n.Name())
+		emit := opts.IncludeInputNodes || emitsByDefault(n)
+		if emitOnly != nil {
+			emit = emitOnly[n.Name()]
+		}
+		if len(opts.EmitTags) > 0 {
+			emit = emit && hasAnyTag(n, opts.EmitTags)
+		}
+		if emit {
 			if result, ok := res.(Result); ok {
 				q := "<nil>"
 				p := "<nil>"
 				v := "<nil>"
 				if result.Q != nil {
-					q = fmt.Sprintf("%v", float64(*result.Q))
+					q = utils.FormatDecimal(float64(*result.Q), ResultFormatPlaces)
 				}
 				if result.P != nil {
-					p = fmt.Sprintf("%v", float64(*result.P))
+					p = utils.FormatDecimal(float64(*result.P), ResultFormatPlaces)
 				}
 				if result.V != nil {
-					v = fmt.Sprintf("%v", float64(*result.V))
+					v = utils.FormatDecimal(float64(*result.V), ResultFormatPlaces)
 				}
-				results[n.Name()] = fmt.Sprintf("{%s, %s, %s}", q, p, v)
+				run.results[n.Name()] = fmt.Sprintf("{%s, %s, %s}", q, p, v)
+			} else if f, ok := res.(float64); ok {
+				rounded, err := t.rounding.round(m, n, f)
+				if err != nil {
+					return nil, fmt.Errorf("rounding node %s: %w", n.Name(), err)
+				}
+				run.results[n.Name()] = rounded
 			} else {
-				results[n.Name()] = res
+				run.results[n.Name()] = res
 			}
 		}
 	}
-	return results, nil
+	if err := t.checkInvariants(done); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// firstSkippedDependency 返回节点第一个被停用或已跳过的依赖，没有时返回空串。
+func firstSkippedDependency(n Node, disabled map[string]bool, skipped []string) string {
+	for _, dep := range n.Requires() {
+		if isOptionalDep(n, dep) {
+			continue
+		}
+		if disabled[dep] {
+			return dep
+		}
+		for _, name := range skipped {
+			if name == dep {
+				return dep
+			}
+		}
+	}
+	return ""
+}
+
+// NodeComputeError 表示节点计算失败，Path 为按执行顺序排列的上游公式节点，末尾为失败节点。
+type NodeComputeError struct {
+	Node string
+	Path []string
+	Err  error
+}
+
+func (e *NodeComputeError) Error() string {
+	return fmt.Sprintf("node %s compute failed: %v", e.Node, e.Err)
+}
+
+func (e *NodeComputeError) Unwrap() error { return e.Err }
+
+// executionPath 返回 ordered 中 name 的全部上游公式节点（保持执行顺序）及 name 本身。
+func executionPath(ordered []Node, name string, registry map[string]Node) []string {
+	upstream := make(map[string]bool)
+	var mark func(string)
+	mark = func(node string) {
+		n, ok := registry[node]
+		if !ok {
+			return
+		}
+		for _, dep := range n.Requires() {
+			if !upstream[dep] {
+				upstream[dep] = true
+				mark(dep)
+			}
+		}
+	}
+	mark(name)
+
+	path := make([]string, 0, len(upstream)+1)
+	for _, n := range ordered {
+		if upstream[n.Name()] && !isInputNode(n) {
+			path = append(path, n.Name())
+		}
+	}
+	return append(path, name)
+}
+
+// computeNode 计算单个节点，启用节点缓存时优先复用缓存结果。
+func (m ContextInput) computeNode(n Node, done map[string]interface{}, opts CalcOptions) (interface{}, error) {
+	formula, ok := n.(FormulaNode)
+	if opts.NodeCache == nil || !ok {
+		return n.Compute(m, done)
+	}
+
+	key, err := m.nodeCacheKey(formula, done)
+	if err != nil {
+		return nil, err
+	}
+	if cached, ok := opts.NodeCache.Get(key); ok {
+		return cached, nil
+	}
+	res, err := n.Compute(m, done)
+	if err != nil {
+		return nil, err
+	}
+	ttl := opts.NodeCacheTTL
+	if ttl <= 0 {
+		ttl = DefaultNodeCacheTTL
+	}
+	opts.NodeCache.Set(key, res, ttl)
+	return res, nil
+}
+
+// nodeCacheKey 由节点名、声明字段的取值、依赖结果与 Meta 拼出缓存键。
+func (m ContextInput) nodeCacheKey(n FormulaNode, done map[string]interface{}) (string, error) {
+	var b strings.Builder
+	b.WriteString(n.name)
+	for _, field := range n.InputFields {
+		value, err := m.fieldValue(field)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "|%s=%s", field, value)
+	}
+	for _, dep := range n.Requires() {
+		fmt.Fprintf(&b, "|%s=%s", dep, formatCacheValue(done[dep]))
+	}
+	if params, ok := done[paramsKey].(map[string]float64); ok {
+		fmt.Fprintf(&b, "|%s=%s", paramsKey, formatParams(params))
+	}
+	if policy, ok := done[zeroDenominatorKey].(ZeroDenominatorPolicy); ok {
+		fmt.Fprintf(&b, "|%s=%d", zeroDenominatorKey, policy)
+	}
+	// 公式可能读取 Meta（如 elasticity），未声明具体键，因此整体计入缓存键。
+	b.WriteString(formatMeta(m.Meta))
+	return b.String(), nil
+}
+
+// formatCacheValue 将依赖结果格式化为稳定的字符串，避免指针地址进入缓存键。
+func formatCacheValue(v interface{}) string {
+	switch value := v.(type) {
+	case Result:
+		return fmt.Sprintf("{%s,%s,%s}", formatOptional(value.Q), formatOptional(value.P), formatOptional(value.V))
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	default:
+		return fmt.Sprintf("%v", value)
+	}
+}
+
+func formatOptional(f *OptionalFloat) string {
+	if f == nil {
+		return "<nil>"
+	}
+	return strconv.FormatFloat(float64(*f), 'g', -1, 64)
 }
 
 // TTLCache 是带过期机制的内存缓存。
 type TTLCache struct {
 	cache map[string]cacheEntry
 	mutex sync.RWMutex
+	clock func() time.Time
+
+	// order 按最近访问排序键，表头最新；maxEntries 大于 0 时超出容量淘汰表尾。
+	order      *list.List
+	maxEntries int
 }
 
 type cacheEntry struct {
 	value      interface{}
 	expiration time.Time
+	element    *list.Element
 }
 
-// NewTTLCache 创建缓存实例。
+// NewTTLCache 创建不限容量的缓存实例。
 func NewTTLCache() *TTLCache {
+	return NewTTLCacheWithCapacity(0)
+}
+
+// NewTTLCacheWithCapacity 创建最多保存 max 个条目的缓存，超出时淘汰最久未访问的条目；max <= 0 表示不限容量。
+func NewTTLCacheWithCapacity(max int) *TTLCache {
 	return &TTLCache{
-		cache: make(map[string]cacheEntry),
+		cache:      make(map[string]cacheEntry),
+		clock:      time.Now,
+		order:      list.New(),
+		maxEntries: max,
 	}
 }
 
+// WithClock 替换缓存使用的时钟，便于测试中确定性地推进时间。
+func (c *TTLCache) WithClock(clock func() time.Time) *TTLCache {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.clock = clock
+	return c
+}
+
 // Set 写入带 TTL 的缓存。
 func (c *TTLCache) Set(key string, value interface{}, ttl time.Duration) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	c.cache[key] = cacheEntry{
-		value:      value,
-		expiration: time.Now().Add(ttl),
+	entry, ok := c.cache[key]
+	if ok {
+		c.order.MoveToFront(entry.element)
+	} else {
+		entry.element = c.order.PushFront(key)
+	}
+	entry.value = value
+	entry.expiration = c.clock().Add(ttl)
+	c.cache[key] = entry
+
+	if c.maxEntries > 0 && len(c.cache) > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.cache, oldest.Value.(string))
 	}
 }
 
-// Get 读取未过期的缓存值。
+// Get 读取未过期的缓存值，并将其标记为最近访问；命中已过期的条目时将其移除。
 func (c *TTLCache) Get(key string) (interface{}, bool) {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	entry, ok := c.cache[key]
-	if !ok || time.Now().After(entry.expiration) {
+	if !ok {
+		return nil, false
+	}
+	if c.clock().After(entry.expiration) {
+		c.order.Remove(entry.element)
+		delete(c.cache, key)
 		return nil, false
 	}
+	c.order.MoveToFront(entry.element)
 	return entry.value, true
 }
 
+// Keys 返回所有未过期的键，按字典序排列。
+func (c *TTLCache) Keys() []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	now := c.clock()
+	keys := make([]string, 0, len(c.cache))
+	for key, entry := range c.cache {
+		if !now.After(entry.expiration) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SortCacheKeys 返回排序缓存中未过期的模板签名，可用于观察缓存键数量是否失控。
+func SortCacheKeys() []string {
+	return sortCache.Keys()
+}
+
 const (
 	// 默认输入节点标识符。
 	KeyObservedMetrics   = "observed_metrics"
@@ -295,6 +1255,7 @@ const (
 	KeyScenarioAInputs   = "scenario_a_inputs"
 	KeyScenarioBInputs   = "scenario_b_inputs"
 	KeyOverheadAdjusters = "overhead_adjusters"
+	KeyPeriod            = "period"
 	// 默认公式节点标识符。
 	KeyBaseCost         = "base_cost"
 	KeySettlementImpact = "settlement_impact"
@@ -302,26 +1263,237 @@ const (
 	KeyTotalCost        = "total_cost"
 	KeyNetMargin        = "net_margin"
 	KeyUnitYield        = "unit_yield"
+	KeyBlendedPrice     = "blended_price"
+	KeyOverheadTotal    = "overhead_total"
+	KeyBreakEven        = "break_even"
+	// KeyAdjustedTotalCost 是计入带符号间接费用后的总成本，仅在显式开启时加入模板。
+	KeyAdjustedTotalCost = "adjusted_total_cost"
+	// KeySettlementImpactElastic 是按弹性系数调整后的结算影响，仅在显式开启时加入模板。
+	KeySettlementImpactElastic = "settlement_impact_elastic"
+	// KeySeasonalBaseCost 是按期次季节性放大的基础成本，仅在显式开启时加入模板。
+	KeySeasonalBaseCost = "seasonal_base_cost"
 )
 
+// overheadTotal 按 Q × P + V 汇总间接费用分量，全部使用十进制运算。
+// 符号约定：正值为附加费用，负值为返利等抵减项（如 V 为 -0.5 表示固定返利 0.5），
+// 会按十进制减法语义降低总额；Q 与 P 需同时提供才计入变动部分，缺失的 V 按 0 处理，三者全部缺失时报错。
+func overheadTotal(overhead Result) (float64, error) {
+	if overhead.Q == nil && overhead.P == nil && overhead.V == nil {
+		return 0, fmt.Errorf("overhead inputs are all nil")
+	}
+	if (overhead.Q == nil) != (overhead.P == nil) {
+		return 0, fmt.Errorf("overhead Q and P must be provided together")
+	}
+
+	var variable, fixed float64
+	if overhead.Q != nil {
+		variable = utils.DecimalMul(float64(*overhead.Q), float64(*overhead.P))
+	}
+	if overhead.V != nil {
+		fixed = float64(*overhead.V)
+	}
+	return utils.DecimalAdd(variable, fixed), nil
+}
+
+// NetOverhead 返回带符号的间接费用净额，与 overhead_total 公式的结果一致，负值表示返利大于附加费用。
+func (m ContextInput) NetOverhead() (float64, error) {
+	return overheadTotal(Result{Q: m.OverheadQ, P: m.OverheadP, V: m.OverheadV})
+}
+
+// DefaultElasticity 是 Meta["elasticity"] 缺省时使用的弹性系数，即不做调整。
+const DefaultElasticity = 1.0
+
+// elasticity 读取 Meta["elasticity"] 中的弹性系数，未设置时返回 DefaultElasticity。
+func (m ContextInput) elasticity() (float64, error) {
+	raw, ok := m.Meta["elasticity"]
+	if !ok {
+		return DefaultElasticity, nil
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("invalid elasticity %q", raw)
+	}
+	return value, nil
+}
+
+// breakEvenPlaces 是盈亏平衡数量的保留小数位。
+const breakEvenPlaces = 4
+
+// BreakEvenQuantity 返回覆盖固定成本所需的数量：fixedCost / unitMargin，保留 4 位小数。
+// 单位边际为零或负数时永远无法盈亏平衡，返回错误。
+func BreakEvenQuantity(fixedCost, unitMargin float64) (float64, error) {
+	if utils.DecimalIsZero(unitMargin) {
+		return 0, fmt.Errorf("break-even undefined: unit margin is zero")
+	}
+	if unitMargin < 0 {
+		return 0, fmt.Errorf("break-even unreachable: unit margin %v is negative", unitMargin)
+	}
+	return utils.DecimalDivide(fixedCost, unitMargin, breakEvenPlaces), nil
+}
+
+// UnitYieldNode 构建以任意输入节点分量为分母的单位收益公式：净收益 / 分母，保留 places 位小数。
+// 节点名为 unit_yield_by_<输入节点>_<分量>，分母为零时的结果由模板的 ZeroDenominatorPolicy 决定（默认 0）。
+func UnitYieldNode(denominatorInput string, component string, places int) FormulaNode {
+	name := fmt.Sprintf("%s_by_%s_%s", KeyUnitYield, denominatorInput, strings.ToLower(component))
+	return unitYieldNode(name, denominatorInput, component, places)
+}
+
+// RatioNode 构建两个公式节点结果之比的节点，按 places 位小数四舍五入，分母为零时返回 0。
+func RatioNode(name, numerator, denominator string, places int) FormulaNode {
+	return FormulaNode{
+		name: name,
+		deps: []string{numerator, denominator},
+		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
+			num, ok := prev[numerator].(float64)
+			if !ok {
+				return 0, fmt.Errorf("%s is unavailable", numerator)
+			}
+			den, ok := prev[denominator].(float64)
+			if !ok {
+				return 0, fmt.Errorf("%s is unavailable", denominator)
+			}
+			if utils.DecimalIsZero(den) {
+				return 0, nil
+			}
+			return utils.DecimalDivide(num, den, places), nil
+		},
+	}
+}
+
+func unitYieldNode(name, denominatorInput, component string, places int) FormulaNode {
+	return FormulaNode{
+		name: name,
+		Tags: []string{TagYield},
+		deps: []string{KeyNetMargin, denominatorInput},
+		Unit: UnitValue + "/" + ComponentUnit(component),
+		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
+			denominator, ok := prev[denominatorInput].(Result)
+			if !ok {
+				return 0, fmt.Errorf("invalid %s data", denominatorInput)
+			}
+			value, err := denominator.Component(component)
+			if err != nil {
+				return 0, err
+			}
+			if value == nil {
+				return 0, fmt.Errorf("%s.%s is nil", denominatorInput, component)
+			}
+			netMargin, ok := prev[KeyNetMargin].(float64)
+			if !ok {
+				return 0, fmt.Errorf("net margin is unavailable")
+			}
+
+			if utils.DecimalIsZero(float64(*value)) {
+				return zeroDenominatorResult(prev, name)
+			}
+
+			return utils.DecimalDivide(netMargin, float64(*value), places), nil
+		},
+	}
+}
+
+const (
+	// BranchScenarioACheaper 表示场景 A 价格低于场景 B。
+	BranchScenarioACheaper = "scenario_a_cheaper"
+	// BranchScenarioBCheaperOrEqual 表示场景 B 价格不高于场景 A。
+	BranchScenarioBCheaperOrEqual = "scenario_b_cheaper_or_equal"
+)
+
+// settlementInputFields 是结算影响与场景收益直接校验的上下文字段。
+var settlementInputFields = []string{"ScenarioAP", "ScenarioBP", "ScenarioAQ", "BaselineQ", "AggregateQ", "ObservedQ"}
+
+// scenarioPriceBranch 描述结算影响与场景收益按场景价格比较选择的分支。
+func scenarioPriceBranch(_ ContextInput, prev map[string]interface{}) string {
+	scenarioA, okA := prev[KeyScenarioAInputs].(Result)
+	scenarioB, okB := prev[KeyScenarioBInputs].(Result)
+	if !okA || !okB || scenarioA.P == nil || scenarioB.P == nil {
+		return ""
+	}
+	if float64(*scenarioA.P) < float64(*scenarioB.P) {
+		return BranchScenarioACheaper
+	}
+	return BranchScenarioBCheaperOrEqual
+}
+
 var (
-	formulaRegistry map[string]Node
-	inputRegistry   map[string]Node
-	registryMutex   sync.RWMutex
-	sortCache       *TTLCache
+	// registries 指向当前生效的注册表快照。快照发布后不再修改，写入方复制后整体替换，
+	// 因此读取方无需加锁，且总能看到某一版本的完整注册表。
+	registries atomic.Pointer[registrySnapshot]
+	// registryMutex 串行化注册表的写入方。
+	registryMutex sync.Mutex
+	sortCache     *TTLCache
 )
 
-// RegisterInputNode 注册自定义输入适配器。
-func RegisterInputNode(name string, adapter InputAdapter) {
+// registrySnapshot 是公式与输入注册表的不可变快照。
+type registrySnapshot struct {
+	generation uint64
+	formulas   map[string]Node
+	inputs     map[string]Node
+}
+
+// currentRegistries 返回当前生效的注册表快照。
+func currentRegistries() *registrySnapshot {
+	return registries.Load()
+}
+
+// lookup 依次在输入与公式注册表中查找节点。
+func (s *registrySnapshot) lookup(name string) (Node, bool) {
+	if node, ok := s.inputs[name]; ok {
+		return node, true
+	}
+	node, ok := s.formulas[name]
+	return node, ok
+}
+
+// updateRegistries 复制当前快照，交给 mutate 修改后原子发布为新版本。
+func updateRegistries(mutate func(formulas, inputs map[string]Node)) {
 	registryMutex.Lock()
 	defer registryMutex.Unlock()
-	if inputRegistry == nil {
-		inputRegistry = make(map[string]Node)
+	current := registries.Load()
+	next := &registrySnapshot{
+		generation: current.generation + 1,
+		formulas:   make(map[string]Node, len(current.formulas)),
+		inputs:     make(map[string]Node, len(current.inputs)),
+	}
+	for name, n := range current.formulas {
+		next.formulas[name] = n
 	}
-	inputRegistry[name] = inputNode{
-		name:    name,
-		resolve: adapter,
+	for name, n := range current.inputs {
+		next.inputs[name] = n
 	}
+	mutate(next.formulas, next.inputs)
+	registries.Store(next)
+}
+
+// SwapRegistries 用给定的公式与输入适配器整体替换全局注册表，公式按 map 的键注册。
+// 替换是原子的：并发构建的模板要么只看到旧注册表，要么只看到新注册表；已构建的模板不受影响。
+func SwapRegistries(formulas map[string]FormulaNode, inputs map[string]InputAdapter) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	next := &registrySnapshot{
+		generation: registries.Load().generation + 1,
+		formulas:   make(map[string]Node, len(formulas)),
+		inputs:     make(map[string]Node, len(inputs)),
+	}
+	for name, n := range formulas {
+		n.name = name
+		next.formulas[name] = n
+	}
+	for name, adapter := range inputs {
+		next.inputs[name] = inputNode{name: name, resolve: adapter, id: nextInputNodeID()}
+	}
+	registries.Store(next)
+}
+
+// RegisterInputNode 注册自定义输入适配器。
+func RegisterInputNode(name string, adapter InputAdapter) {
+	updateRegistries(func(_, inputs map[string]Node) {
+		inputs[name] = inputNode{
+			name:    name,
+			resolve: adapter,
+			id:      nextInputNodeID(),
+		}
+	})
 }
 
 // RegisterInputAdapter 是 RegisterInputNode 的同义接口，更强调适配语义。
@@ -329,20 +1501,48 @@ func RegisterInputAdapter(name string, adapter InputAdapter) {
 	RegisterInputNode(name, adapter)
 }
 
+// lazyInputNode 是按需获取数据的输入节点，只有模板依赖它时才会被计算。
+type lazyInputNode struct {
+	name  string
+	fetch func(ContextInput) (Result, error)
+	id    uint64
+}
+
+func (n lazyInputNode) Name() string { return n.name }
+
+func (n lazyInputNode) Requires() []string { return nil }
+
+func (n lazyInputNode) Compute(m ContextInput, _ map[string]interface{}) (interface{}, error) {
+	return memoizedInput(n.name, n.id, m, func() (Result, error) {
+		return n.fetch(m)
+	})
+}
+
+// RegisterLazyInputNode 注册按需获取的输入节点，适用于需要访问数据库或 RPC 的昂贵输入。
+// fetch 仅在模板依赖该节点时调用，且在单次 Calc 内只调用一次。
+func RegisterLazyInputNode(name string, fetch func(ContextInput) (Result, error)) {
+	updateRegistries(func(_, inputs map[string]Node) {
+		inputs[name] = lazyInputNode{
+			name:  name,
+			fetch: fetch,
+			id:    nextInputNodeID(),
+		}
+	})
+}
+
 // RegisterFormula 将公式节点写入全局注册表。
 func RegisterFormula(n FormulaNode) {
-	registryMutex.Lock()
-	defer registryMutex.Unlock()
-	if formulaRegistry == nil {
-		formulaRegistry = make(map[string]Node)
-	}
-	formulaRegistry[n.name] = n
+	updateRegistries(func(formulas, _ map[string]Node) {
+		formulas[n.name] = n
+	})
 }
 
 func init() {
-	inputRegistry = make(map[string]Node)
-	formulaRegistry = make(map[string]Node)
-	sortCache = NewTTLCache()
+	registries.Store(&registrySnapshot{
+		formulas: make(map[string]Node),
+		inputs:   make(map[string]Node),
+	})
+	sortCache = NewTTLCacheWithCapacity(sortCacheCapacity)
 
 	RegisterInputNode(KeyObservedMetrics, func(m ContextInput) (q, p, v *OptionalFloat) {
 		return m.ObservedQ, m.ObservedP, m.ObservedV
@@ -362,11 +1562,18 @@ func init() {
 	RegisterInputNode(KeyOverheadAdjusters, func(m ContextInput) (q, p, v *OptionalFloat) {
 		return m.OverheadQ, m.OverheadP, m.OverheadV
 	})
+	// 期次节点：Q 分量承载 float64(Period)，便于公式把期次作为显式依赖（如季节性调整）。
+	RegisterInputNode(KeyPeriod, func(m ContextInput) (q, p, v *OptionalFloat) {
+		return NewOptionalFloat(float64(m.Period)), nil, nil
+	})
 
 	// 基础成本 = 基线 + 场景 A + 场景 B 的估值。
 	RegisterFormula(FormulaNode{
-		name: KeyBaseCost,
-		deps: []string{KeyBaselineMetrics, KeyScenarioAInputs, KeyScenarioBInputs},
+		name:        KeyBaseCost,
+		Tags:        []string{TagCost},
+		Unit:        UnitValue,
+		deps:        []string{KeyBaselineMetrics, KeyScenarioAInputs, KeyScenarioBInputs},
+		InputFields: []string{"BaselineV", "ScenarioAV", "ScenarioBV"},
 		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
 			if m.BaselineV == nil {
 				return 0, fmt.Errorf("context.BaselineV is nil")
@@ -401,7 +1608,10 @@ func init() {
 
 	// 结算影响：根据场景估算量、观测量与价格差。
 	RegisterFormula(FormulaNode{
-		name: KeySettlementImpact,
+		name:   KeySettlementImpact,
+		Tags:   []string{TagCost},
+		branch: scenarioPriceBranch,
+		Unit:   UnitValue,
 		deps: []string{
 			KeyAggregateMetrics,
 			KeyBaselineMetrics,
@@ -409,6 +1619,7 @@ func init() {
 			KeyScenarioBInputs,
 			KeyObservedMetrics,
 		},
+		InputFields: settlementInputFields,
 		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
 			if m.ScenarioAP == nil || m.ScenarioBP == nil || m.ScenarioAQ == nil || m.BaselineQ == nil || m.AggregateQ == nil || m.ObservedQ == nil {
 				return 0, fmt.Errorf("missing required settlement inputs")
@@ -458,7 +1669,10 @@ func init() {
 
 	// 场景收益：评估观测交付与场景假设差异带来的收益。
 	RegisterFormula(FormulaNode{
-		name: KeyScenarioMargin,
+		name:   KeyScenarioMargin,
+		Tags:   []string{TagMargin},
+		branch: scenarioPriceBranch,
+		Unit:   UnitValue,
 		deps: []string{
 			KeyAggregateMetrics,
 			KeyBaselineMetrics,
@@ -466,6 +1680,7 @@ func init() {
 			KeyScenarioBInputs,
 			KeyObservedMetrics,
 		},
+		InputFields: settlementInputFields,
 		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
 			if m.ScenarioAP == nil || m.ScenarioBP == nil || m.ScenarioAQ == nil || m.BaselineQ == nil || m.AggregateQ == nil || m.ObservedQ == nil {
 				return 0, fmt.Errorf("missing required scenario margin inputs")
@@ -498,13 +1713,13 @@ func init() {
 
 			var result float64
 			if float64(*scenarioAPrice.P) < float64(*scenarioBPrice.P) {
-				observedAdjusted := utils.DecimalMul(float64(*observed.Q), 1.2)
+				observedAdjusted := utils.DecimalMul(float64(*observed.Q), Param(prev, ParamObservedAdjustment, 1.2))
 				sumQ := utils.DecimalAdd(float64(*scenarioA.Q), float64(*baseline.Q))
 				sumQ = utils.DecimalSubtract(sumQ, observedAdjusted)
 				diffP := utils.DecimalSubtract(float64(*scenarioBPrice.P), float64(*scenarioAPrice.P))
 				result = utils.DecimalMul(sumQ, diffP)
 			} else {
-				aggregateAdjusted := utils.DecimalMul(float64(*aggregate.Q), 0.8)
+				aggregateAdjusted := utils.DecimalMul(float64(*aggregate.Q), Param(prev, ParamAggregateAdjustment, 0.8))
 				diffQ := utils.DecimalSubtract(aggregateAdjusted, float64(*baseline.Q))
 				diffQ = utils.DecimalSubtract(diffQ, float64(*scenarioA.Q))
 				diffP := utils.DecimalSubtract(float64(*scenarioAPrice.P), float64(*scenarioBPrice.P))
@@ -518,6 +1733,8 @@ func init() {
 	// 总成本 = 基础成本 + 结算影响。
 	RegisterFormula(FormulaNode{
 		name: KeyTotalCost,
+		Tags: []string{TagCost},
+		Unit: UnitValue,
 		deps: []string{KeyBaseCost, KeySettlementImpact},
 		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
 			baseCost, ok := prev[KeyBaseCost].(float64)
@@ -533,9 +1750,51 @@ func init() {
 		},
 	})
 
+	// 弹性结算影响 = 结算影响 × 弹性系数。系数取自 Meta["elasticity"]，缺省为 1 即与结算影响相同，
+	// 小于 1 表示需求响应减弱、结算影响按比例收缩。
+	RegisterFormula(FormulaNode{
+		name: KeySettlementImpactElastic,
+		Tags: []string{TagCost},
+		Unit: UnitValue,
+		deps: []string{KeySettlementImpact},
+		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
+			settlement, ok := prev[KeySettlementImpact].(float64)
+			if !ok {
+				return 0, fmt.Errorf("settlement impact is unavailable")
+			}
+			elasticity, err := m.elasticity()
+			if err != nil {
+				return 0, err
+			}
+			return utils.DecimalMul(settlement, elasticity), nil
+		},
+	})
+
+	// 季节性基础成本 = 基础成本 × (1 + (期次 - 1) × 10%)，即第 1 期不调整、之后每期递增 10%。
+	RegisterFormula(FormulaNode{
+		name: KeySeasonalBaseCost,
+		Tags: []string{TagCost},
+		Unit: UnitValue,
+		deps: []string{KeyBaseCost, KeyPeriod},
+		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
+			baseCost, ok := prev[KeyBaseCost].(float64)
+			if !ok {
+				return 0, fmt.Errorf("base cost is unavailable")
+			}
+			period, ok := prev[KeyPeriod].(Result)
+			if !ok || period.Q == nil {
+				return 0, fmt.Errorf("invalid period data")
+			}
+			factor := utils.DecimalAdd(1, utils.DecimalMul(utils.DecimalSubtract(float64(*period.Q), 1), 0.1))
+			return utils.DecimalMul(baseCost, factor), nil
+		},
+	})
+
 	// 净收益 = 结算影响 - 场景收益。
 	RegisterFormula(FormulaNode{
 		name: KeyNetMargin,
+		Tags: []string{TagMargin},
+		Unit: UnitValue,
 		deps: []string{KeySettlementImpact, KeyScenarioMargin},
 		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
 			settlement, ok := prev[KeySettlementImpact].(float64)
@@ -552,27 +1811,86 @@ func init() {
 	})
 
 	// 单位收益 = 净收益 / 汇总量。
+	RegisterFormula(unitYieldNode(KeyUnitYield, KeyAggregateMetrics, "Q", 4))
+
+	// 总间接费用 = 间接数量 × 单位间接费率 + 固定间接费用，符号约定见 overheadTotal。
 	RegisterFormula(FormulaNode{
-		name: KeyUnitYield,
-		deps: []string{KeyNetMargin, KeyAggregateMetrics},
+		name: KeyOverheadTotal,
+		Tags: []string{TagCost},
+		deps: []string{KeyOverheadAdjusters},
+		Unit: UnitValue,
 		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
-			if m.AggregateQ == nil {
-				return 0, fmt.Errorf("context.AggregateQ is nil")
+			overhead, ok := prev[KeyOverheadAdjusters].(Result)
+			if !ok {
+				return 0, fmt.Errorf("invalid overhead adjusters data")
 			}
-			aggregate, ok := prev[KeyAggregateMetrics].(Result)
-			if !ok || aggregate.Q == nil {
-				return 0, fmt.Errorf("invalid aggregate metrics data")
+			return overheadTotal(overhead)
+		},
+	})
+
+	// 含间接费用的总成本 = 总成本 + 总间接费用，间接费用为负（返利）时低于 total_cost。
+	RegisterFormula(FormulaNode{
+		name: KeyAdjustedTotalCost,
+		Tags: []string{TagCost},
+		deps: []string{KeyTotalCost, KeyOverheadTotal},
+		Unit: UnitValue,
+		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
+			total, ok := prev[KeyTotalCost].(float64)
+			if !ok {
+				return 0, fmt.Errorf("total cost is unavailable")
 			}
-			netMargin, ok := prev[KeyNetMargin].(float64)
+			overhead, ok := prev[KeyOverheadTotal].(float64)
 			if !ok {
-				return 0, fmt.Errorf("net margin is unavailable")
+				return 0, fmt.Errorf("overhead total is unavailable")
 			}
+			return utils.DecimalAdd(total, overhead), nil
+		},
+	})
 
-			if float64(*aggregate.Q) == 0 {
-				return 0, nil
+	// 加权混合价 = (A.Q*A.P + B.Q*B.P) / (A.Q + B.Q)。
+	RegisterFormula(FormulaNode{
+		name: KeyBlendedPrice,
+		Tags: []string{TagPrice},
+		deps: []string{KeyScenarioAInputs, KeyScenarioBInputs},
+		Unit: UnitPrice,
+		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
+			scenarioA, ok := prev[KeyScenarioAInputs].(Result)
+			if !ok || scenarioA.Q == nil || scenarioA.P == nil {
+				return 0, fmt.Errorf("invalid scenario A quantity or price")
+			}
+			scenarioB, ok := prev[KeyScenarioBInputs].(Result)
+			if !ok || scenarioB.Q == nil || scenarioB.P == nil {
+				return 0, fmt.Errorf("invalid scenario B quantity or price")
 			}
 
-			return utils.DecimalDivide(netMargin, float64(*aggregate.Q), 4), nil
+			totalQ := utils.DecimalAdd(float64(*scenarioA.Q), float64(*scenarioB.Q))
+			if utils.DecimalIsZero(totalQ) {
+				return 0, fmt.Errorf("blended price undefined: scenario A and B quantities sum to zero")
+			}
+			weighted := utils.DecimalAdd(
+				utils.DecimalMul(float64(*scenarioA.Q), float64(*scenarioA.P)),
+				utils.DecimalMul(float64(*scenarioB.Q), float64(*scenarioB.P)),
+			)
+			return utils.DecimalDivide(weighted, totalQ, 4), nil
+		},
+	})
+
+	// 盈亏平衡数量 = 总间接费用 / 单位收益。量纲 value/(value/quantity) 即数量。
+	RegisterFormula(FormulaNode{
+		name: KeyBreakEven,
+		Tags: []string{TagMargin},
+		deps: []string{KeyOverheadTotal, KeyUnitYield},
+		Unit: UnitValue + "/(" + UnitValue + "/" + UnitQuantity + ")",
+		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
+			overhead, ok := prev[KeyOverheadTotal].(float64)
+			if !ok {
+				return 0, fmt.Errorf("overhead total is unavailable")
+			}
+			unitYield, ok := prev[KeyUnitYield].(float64)
+			if !ok {
+				return 0, fmt.Errorf("unit yield is unavailable")
+			}
+			return BreakEvenQuantity(overhead, unitYield)
 		},
 	})
 }
@@ -1,8 +1,13 @@
 package dynamicformula
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/force-c/dynamic-formula/utils"
 	"github.com/shopspring/decimal"
@@ -41,6 +46,8 @@ func TestCalc_BaseCost(t *testing.T) {
 	for k, v := range data {
 		t.Logf("key %s value %v", k, v)
 	}
+	AssertResultClose(t, data, KeyBaseCost, 17, 1e-9)
+	AssertResultClose(t, data, KeyBaselineMetrics+".V", 10, 1e-9)
 }
 
 func TestCalc_TotalCost(t *testing.T) {
@@ -71,10 +78,13 @@ func TestCalc_TotalCost(t *testing.T) {
 	for k, v := range data {
 		t.Logf("key %s value %v", k, v)
 	}
+	AssertResultClose(t, data, KeyTotalCost, 14, 1e-9)
+	AssertResultClose(t, data, KeyBaseCost, 14, 1e-9)
+	AssertResultClose(t, data, KeySettlementImpact, 0, 1e-9)
 }
 
 func TestCalc_SettlementImpact(t *testing.T) {
-	f, _ := formulaRegistry[KeySettlementImpact]
+	f, _ := currentRegistries().formulas[KeySettlementImpact]
 	template := NewCalcTemplate(f)
 
 	t.Run("scenario A price higher", func(t *testing.T) {
@@ -98,6 +108,7 @@ func TestCalc_SettlementImpact(t *testing.T) {
 		for k, v := range data {
 			t.Logf("key %s value %v", k, v)
 		}
+		AssertResultClose(t, data, KeySettlementImpact, -16, 1e-9)
 	})
 
 	t.Run("scenario B price higher", func(t *testing.T) {
@@ -121,11 +132,12 @@ func TestCalc_SettlementImpact(t *testing.T) {
 		for k, v := range data {
 			t.Logf("key %s value %v", k, v)
 		}
+		AssertResultClose(t, data, KeySettlementImpact, -52, 1e-9)
 	})
 }
 
 func TestCalc_ScenarioMargin(t *testing.T) {
-	f, _ := formulaRegistry[KeyScenarioMargin]
+	f, _ := currentRegistries().formulas[KeyScenarioMargin]
 	template := NewCalcTemplate(f)
 
 	t.Run("scenario A price higher", func(t *testing.T) {
@@ -149,6 +161,7 @@ func TestCalc_ScenarioMargin(t *testing.T) {
 		for k, v := range data {
 			t.Logf("key %s value %v", k, v)
 		}
+		AssertResultClose(t, data, KeyScenarioMargin, 10.4, 1e-9)
 	})
 
 	t.Run("scenario B price higher", func(t *testing.T) {
@@ -172,11 +185,12 @@ func TestCalc_ScenarioMargin(t *testing.T) {
 		for k, v := range data {
 			t.Logf("key %s value %v", k, v)
 		}
+		AssertResultClose(t, data, KeyScenarioMargin, 18.4, 1e-9)
 	})
 }
 
 func TestCalc_NetMargin(t *testing.T) {
-	f, _ := formulaRegistry[KeyNetMargin]
+	f, _ := currentRegistries().formulas[KeyNetMargin]
 	template := NewCalcTemplate(f)
 
 	t.Run("scenario A price higher", func(t *testing.T) {
@@ -200,6 +214,7 @@ func TestCalc_NetMargin(t *testing.T) {
 		for k, v := range data {
 			t.Logf("key %s value %v", k, v)
 		}
+		AssertResultClose(t, data, KeyNetMargin, -20.8, 1e-9)
 	})
 
 	t.Run("scenario B price higher", func(t *testing.T) {
@@ -223,11 +238,12 @@ func TestCalc_NetMargin(t *testing.T) {
 		for k, v := range data {
 			t.Logf("key %s value %v", k, v)
 		}
+		AssertResultClose(t, data, KeyNetMargin, -46.4, 1e-9)
 	})
 }
 
 func TestCalc_UnitYield(t *testing.T) {
-	f, _ := formulaRegistry[KeyUnitYield]
+	f, _ := currentRegistries().formulas[KeyUnitYield]
 	template := NewCalcTemplate(f)
 
 	t.Run("non-zero aggregate quantity", func(t *testing.T) {
@@ -251,6 +267,8 @@ func TestCalc_UnitYield(t *testing.T) {
 		for k, v := range data {
 			t.Logf("key %s value %v", k, v)
 		}
+		AssertResultClose(t, data, KeyUnitYield, -2.55, 1e-9)
+		AssertResultClose(t, data, KeyAggregateMetrics+".Q", 16, 1e-9)
 	})
 
 	t.Run("zero aggregate quantity", func(t *testing.T) {
@@ -274,6 +292,7 @@ func TestCalc_UnitYield(t *testing.T) {
 		for k, v := range data {
 			t.Logf("key %s value %v", k, v)
 		}
+		AssertResultClose(t, data, KeyUnitYield, 0, 1e-9)
 	})
 }
 
@@ -356,6 +375,12 @@ func TestCalc_FullTemplate(t *testing.T) {
 		},
 	}
 
+	expected := map[int]map[string]float64{
+		1: {KeyBaseCost: 15.155, KeySettlementImpact: 0.245, KeyScenarioMargin: 0.133, KeyTotalCost: 15.4, KeyNetMargin: 0.112, KeyUnitYield: 0.14},
+		2: {KeyBaseCost: 22.615, KeySettlementImpact: 0.12, KeyScenarioMargin: 0.054, KeyTotalCost: 22.735, KeyNetMargin: 0.066, KeyUnitYield: 0.06},
+		3: {KeyBaseCost: 12.222, KeySettlementImpact: -0.207, KeyScenarioMargin: -0.315, KeyTotalCost: 12.015, KeyNetMargin: 0.108, KeyUnitYield: 0.18},
+	}
+
 	template := NewFullCalcTemplate()
 
 	for _, ds := range dataSets {
@@ -378,11 +403,65 @@ func TestCalc_FullTemplate(t *testing.T) {
 			} else {
 				t.Logf("period %d %s: <not found>", ds.Period, key)
 			}
+			AssertResultClose(t, data, key, expected[ds.Period][key], 1e-9)
 		}
 		t.Log()
 	}
 }
 
+// AssertResultClose 断言结果中 key 对应的数值与 want 的差不超过 tol，key 的写法同 ResultValue。
+func AssertResultClose(t testing.TB, results map[string]interface{}, key string, want float64, tol float64) {
+	t.Helper()
+	got, err := ResultValue(results, key)
+	if err != nil {
+		t.Errorf("result %s: %v", key, err)
+		return
+	}
+	if math.Abs(got-want) > tol {
+		t.Errorf("result %s = %v, want %v (tolerance %v)", key, got, want, tol)
+	}
+}
+
+// recordingTB 记录断言失败而不终止测试，用于校验断言辅助函数本身。
+type recordingTB struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func TestAssertResultClose(t *testing.T) {
+	results := map[string]interface{}{
+		KeyTotalCost:       15.4,
+		KeyBaselineMetrics: "{0.2, 21.5, 4.3}",
+	}
+
+	cases := []struct {
+		key      string
+		want     float64
+		tol      float64
+		failures int
+	}{
+		{KeyTotalCost, 15.4, 0, 0},
+		{KeyTotalCost, 15.41, 0.02, 0},
+		{KeyTotalCost, 15.5, 0.01, 1},
+		{KeyBaselineMetrics + ".P", 21.5, 0, 0},
+		{KeyBaselineMetrics + ".V", 4.4, 0.01, 1},
+		{KeyNetMargin, 0, 1, 1},
+	}
+	for _, c := range cases {
+		rec := &recordingTB{TB: t}
+		AssertResultClose(rec, results, c.key, c.want, c.tol)
+		if len(rec.failures) != c.failures {
+			t.Errorf("AssertResultClose(%s, %v, %v) failures = %v, want %d", c.key, c.want, c.tol, rec.failures, c.failures)
+		}
+	}
+}
+
 func TestDecimalHelpers(t *testing.T) {
 	sum, _ := decimal.NewFromFloat(2.5).
 		Add(decimal.NewFromFloat(3.75)).
@@ -392,4 +471,1068 @@ func TestDecimalHelpers(t *testing.T) {
 
 	sum2 := utils.DecimalAdd(2.5, 3.75, 1.125)
 	t.Log("helper sum ", sum2)
+	if sum != 7.375 || sum2 != sum {
+		t.Errorf("decimal sum = %v, helper sum = %v, want 7.375", sum, sum2)
+	}
+}
+
+func TestCalc_RejectNonFinite(t *testing.T) {
+	template := NewCalcTemplate(FormulaNode{
+		name: "nan_formula",
+		deps: []string{KeyBaselineMetrics},
+		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
+			return math.NaN(), nil
+		},
+	})
+	input := ContextInput{BaselineV: NewOptionalFloat(1)}
+
+	data, err := input.Calc(template, false)
+	if err != nil {
+		t.Fatalf("default options should not reject NaN: %v", err)
+	}
+	if v, ok := data["nan_formula"].(float64); !ok || !math.IsNaN(v) {
+		t.Fatalf("expected NaN result, got %v", data["nan_formula"])
+	}
+
+	_, err = input.CalcWithOptions(template, CalcOptions{RejectNonFinite: true})
+	if err == nil {
+		t.Fatal("expected non-finite error")
+	}
+	if !strings.Contains(err.Error(), "node nan_formula produced non-finite result") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestUnitYieldNode_ObservedQuantity(t *testing.T) {
+	node := UnitYieldNode(KeyObservedMetrics, "Q", 4)
+	if node.Name() != "unit_yield_by_observed_metrics_q" {
+		t.Fatalf("unexpected node name %s", node.Name())
+	}
+
+	input := ContextInput{
+		AggregateQ: NewOptionalFloat(16),
+		BaselineQ:  NewOptionalFloat(5),
+		ScenarioAQ: NewOptionalFloat(4),
+		ObservedQ:  NewOptionalFloat(2),
+		ScenarioAP: NewOptionalFloat(18),
+		ScenarioBP: NewOptionalFloat(21),
+	}
+
+	data, err := input.Calc(NewCalcTemplate(node, currentRegistries().formulas[KeyUnitYield]), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	netMargin := data[KeyNetMargin].(float64)
+	want := utils.DecimalDivide(netMargin, 2, 4)
+	if got := data[node.Name()].(float64); got != want {
+		t.Fatalf("yield by observed Q = %v, want %v", got, want)
+	}
+	if got := data[KeyUnitYield].(float64); got != utils.DecimalDivide(netMargin, 16, 4) {
+		t.Fatalf("default unit_yield = %v, want division by aggregate Q", got)
+	}
+}
+
+func TestCalc_NodeCacheIgnoresUnrelatedFields(t *testing.T) {
+	computed := 0
+	template := NewCalcTemplate(FormulaNode{
+		name:        "cached_baseline",
+		deps:        []string{KeyBaselineMetrics},
+		InputFields: []string{"BaselineV"},
+		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
+			computed++
+			return float64(*m.BaselineV) * 2, nil
+		},
+	})
+	opts := CalcOptions{NodeCache: NewTTLCache()}
+
+	input := ContextInput{BaselineV: NewOptionalFloat(3), ObservedQ: NewOptionalFloat(1)}
+	if _, err := input.CalcWithOptions(template, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	input.ObservedQ = NewOptionalFloat(99)
+	data, err := input.CalcWithOptions(template, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if computed != 1 {
+		t.Fatalf("unrelated field change recomputed node: computed %d times", computed)
+	}
+	if data["cached_baseline"].(float64) != 6 {
+		t.Fatalf("cached value = %v, want 6", data["cached_baseline"])
+	}
+
+	input.BaselineV = NewOptionalFloat(4)
+	data, err = input.CalcWithOptions(template, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if computed != 2 || data["cached_baseline"].(float64) != 8 {
+		t.Fatalf("relevant field change should miss cache: computed %d, value %v", computed, data["cached_baseline"])
+	}
+}
+
+// samplePeriodInputs 返回与 TestCalc_FullTemplate 相同的三期样例数据。
+func samplePeriodInputs() []ContextInput {
+	return []ContextInput{
+		{
+			Period:     1,
+			ObservedQ:  NewOptionalFloat(0.8),
+			ObservedP:  NewOptionalFloat(19.2),
+			ObservedV:  NewOptionalFloat(15.36),
+			AggregateQ: NewOptionalFloat(0.8),
+			AggregateP: NewOptionalFloat(20.0),
+			AggregateV: NewOptionalFloat(16.0),
+			BaselineQ:  NewOptionalFloat(0.2),
+			BaselineP:  NewOptionalFloat(21.5),
+			BaselineV:  NewOptionalFloat(4.3),
+			ScenarioAQ: NewOptionalFloat(0.25),
+			ScenarioAP: NewOptionalFloat(18.5),
+			ScenarioAV: NewOptionalFloat(4.625),
+			ScenarioBQ: NewOptionalFloat(0.35),
+			ScenarioBP: NewOptionalFloat(17.8),
+			ScenarioBV: NewOptionalFloat(6.23),
+			OverheadQ:  NewOptionalFloat(0),
+			OverheadP:  NewOptionalFloat(0),
+			OverheadV:  NewOptionalFloat(0.8),
+		},
+		{
+			Period:     2,
+			ObservedQ:  NewOptionalFloat(1.1),
+			ObservedP:  NewOptionalFloat(20.5),
+			ObservedV:  NewOptionalFloat(22.55),
+			AggregateQ: NewOptionalFloat(1.1),
+			AggregateP: NewOptionalFloat(19.8),
+			AggregateV: NewOptionalFloat(21.78),
+			BaselineQ:  NewOptionalFloat(0.3),
+			BaselineP:  NewOptionalFloat(22),
+			BaselineV:  NewOptionalFloat(6.6),
+			ScenarioAQ: NewOptionalFloat(0.4),
+			ScenarioAP: NewOptionalFloat(19),
+			ScenarioAV: NewOptionalFloat(7.6),
+			ScenarioBQ: NewOptionalFloat(0.45),
+			ScenarioBP: NewOptionalFloat(18.7),
+			ScenarioBV: NewOptionalFloat(8.415),
+			OverheadQ:  NewOptionalFloat(0),
+			OverheadP:  NewOptionalFloat(0),
+			OverheadV:  NewOptionalFloat(1.1),
+		},
+		{
+			Period:     3,
+			ObservedQ:  NewOptionalFloat(0.6),
+			ObservedP:  NewOptionalFloat(18.1),
+			ObservedV:  NewOptionalFloat(10.86),
+			AggregateQ: NewOptionalFloat(0.6),
+			AggregateP: NewOptionalFloat(18.9),
+			AggregateV: NewOptionalFloat(11.34),
+			BaselineQ:  NewOptionalFloat(0.15),
+			BaselineP:  NewOptionalFloat(21.8),
+			BaselineV:  NewOptionalFloat(3.27),
+			ScenarioAQ: NewOptionalFloat(0.22),
+			ScenarioAP: NewOptionalFloat(17.4),
+			ScenarioAV: NewOptionalFloat(3.828),
+			ScenarioBQ: NewOptionalFloat(0.28),
+			ScenarioBP: NewOptionalFloat(18.3),
+			ScenarioBV: NewOptionalFloat(5.124),
+			OverheadQ:  NewOptionalFloat(0),
+			OverheadP:  NewOptionalFloat(0),
+			OverheadV:  NewOptionalFloat(0.6),
+		},
+	}
+}
+
+func TestNewCalcTemplateWith_IsolatedResolver(t *testing.T) {
+	resolver := MapResolver{
+		"tenant_input": inputNode{
+			name: "tenant_input",
+			resolve: func(m ContextInput) (q, p, v *OptionalFloat) {
+				return m.ObservedQ, m.ObservedP, m.ObservedV
+			},
+		},
+	}
+	if _, ok := lookupRegistered("tenant_input"); ok {
+		t.Fatal("tenant_input must not exist in the global registries")
+	}
+
+	template := NewCalcTemplateWith(resolver, FormulaNode{
+		name: "tenant_value",
+		deps: []string{"tenant_input"},
+		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
+			return float64(*prev["tenant_input"].(Result).V) * 2, nil
+		},
+	})
+
+	data, err := ContextInput{ObservedV: NewOptionalFloat(21)}.Calc(template, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["tenant_value"].(float64) != 42 {
+		t.Fatalf("tenant_value = %v, want 42", data["tenant_value"])
+	}
+}
+
+func TestRegisterLazyInputNode_FetchOnlyWhenRequired(t *testing.T) {
+	preserveRegistries(t)
+	fetches := 0
+	RegisterLazyInputNode("lazy_remote_metrics", func(m ContextInput) (Result, error) {
+		fetches++
+		return Result{V: NewOptionalFloat(7)}, nil
+	})
+	consumer := FormulaNode{
+		name: "lazy_consumer",
+		deps: []string{"lazy_remote_metrics", KeyBaselineMetrics},
+		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
+			return float64(*prev["lazy_remote_metrics"].(Result).V) + float64(*prev["lazy_remote_metrics"].(Result).V), nil
+		},
+	}
+	input := ContextInput{
+		BaselineV:  NewOptionalFloat(1),
+		ScenarioAV: NewOptionalFloat(2),
+		ScenarioBV: NewOptionalFloat(3),
+	}
+
+	if _, err := input.Calc(NewCalcTemplate(currentRegistries().formulas[KeyBaseCost]), true); err != nil {
+		t.Fatal(err)
+	}
+	if fetches != 0 {
+		t.Fatalf("lazy input fetched %d times for a template that does not require it", fetches)
+	}
+
+	data, err := input.Calc(NewCalcTemplate(consumer), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetches != 1 {
+		t.Fatalf("lazy input fetched %d times, want 1", fetches)
+	}
+	AssertResultClose(t, data, "lazy_consumer", 14, 0)
+	if _, ok := data["lazy_remote_metrics"]; ok {
+		t.Fatal("lazy input node should be treated as an input node in results")
+	}
+}
+
+func TestCalc_EmitOnly(t *testing.T) {
+	input := samplePeriodInputs()[0]
+	data, err := input.CalcWithOptions(NewFullCalcTemplate(), CalcOptions{
+		EmitOnly: []string{KeyNetMargin, KeyUnitYield},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 2 {
+		t.Fatalf("expected only net_margin and unit_yield, got %v", data)
+	}
+	AssertResultClose(t, data, KeyNetMargin, 0.112, 1e-9)
+	AssertResultClose(t, data, KeyUnitYield, 0.14, 1e-9)
+
+	if _, err := input.CalcWithOptions(NewFullCalcTemplate(), CalcOptions{EmitOnly: []string{"no_such_node"}}); err == nil {
+		t.Fatal("expected error for unknown emit-only node")
+	}
+}
+
+func TestCalc_BlendedPrice(t *testing.T) {
+	template := NewPricingTemplate()
+
+	t.Run("weighted blend", func(t *testing.T) {
+		input := ContextInput{
+			ScenarioAQ: NewOptionalFloat(0.25),
+			ScenarioAP: NewOptionalFloat(18.5),
+			ScenarioBQ: NewOptionalFloat(0.35),
+			ScenarioBP: NewOptionalFloat(17.8),
+		}
+		data, err := input.Calc(template, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// (0.25*18.5 + 0.35*17.8) / 0.6 = 10.855 / 0.6
+		AssertResultClose(t, data, KeyBlendedPrice, 18.0917, 0)
+	})
+
+	t.Run("zero total quantity", func(t *testing.T) {
+		input := ContextInput{
+			ScenarioAQ: NewOptionalFloat(0),
+			ScenarioAP: NewOptionalFloat(18.5),
+			ScenarioBQ: NewOptionalFloat(0),
+			ScenarioBP: NewOptionalFloat(17.8),
+		}
+		_, err := input.Calc(template, false)
+		if err == nil || !strings.Contains(err.Error(), "quantities sum to zero") {
+			t.Fatalf("expected zero-quantity error, got %v", err)
+		}
+	})
+}
+
+func TestTTLCache_WithClockExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewTTLCache().WithClock(func() time.Time { return now })
+
+	cache.Set("ordering", []string{KeyBaseCost}, time.Minute)
+	if _, ok := cache.Get("ordering"); !ok {
+		t.Fatal("expected hit before expiry")
+	}
+
+	now = now.Add(59 * time.Second)
+	if _, ok := cache.Get("ordering"); !ok {
+		t.Fatal("expected hit just before expiry")
+	}
+
+	now = now.Add(2 * time.Second)
+	if _, ok := cache.Get("ordering"); ok {
+		t.Fatal("expected miss after advancing past TTL")
+	}
+}
+
+func TestCalc_OverheadTotal(t *testing.T) {
+	input := samplePeriodInputs()[0]
+	input.OverheadQ = NewOptionalFloat(2)
+	input.OverheadP = NewOptionalFloat(1.15)
+	input.OverheadV = NewOptionalFloat(0.8)
+
+	data, err := input.Calc(NewFullCalcTemplateWithOptions(FullTemplateOptions{IncludeOverhead: true}), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertResultClose(t, data, KeyOverheadTotal, 3.1, 0)
+	AssertResultClose(t, data, KeyTotalCost, 15.4, 1e-9)
+
+	data, err = input.Calc(NewFullCalcTemplate(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := data[KeyOverheadTotal]; ok {
+		t.Fatal("overhead_total should be opt-in")
+	}
+
+	onlyFixed := ContextInput{OverheadV: NewOptionalFloat(0.6)}
+	data, err = onlyFixed.Calc(NewCalcTemplate(currentRegistries().formulas[KeyOverheadTotal]), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertResultClose(t, data, KeyOverheadTotal, 0.6, 0)
+
+	if _, err := (ContextInput{}).Calc(NewCalcTemplate(currentRegistries().formulas[KeyOverheadTotal]), false); err == nil {
+		t.Fatal("expected error when all overhead inputs are nil")
+	}
+}
+
+func TestCalc_NegativeOverheadReducesCost(t *testing.T) {
+	input := samplePeriodInputs()[0]
+	input.OverheadQ = NewOptionalFloat(2)
+	input.OverheadP = NewOptionalFloat(0.1)
+	input.OverheadV = NewOptionalFloat(-0.7)
+
+	net, err := input.NetOverhead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if net != -0.5 {
+		t.Fatalf("NetOverhead() = %v, want -0.5", net)
+	}
+
+	data, err := input.Calc(NewFullCalcTemplateWithOptions(FullTemplateOptions{IncludeAdjustedTotalCost: true}), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertResultClose(t, data, KeyOverheadTotal, -0.5, 0)
+	AssertResultClose(t, data, KeyAdjustedTotalCost, 14.9, 0)
+	if data[KeyAdjustedTotalCost].(float64) >= data[KeyTotalCost].(float64) {
+		t.Fatalf("rebate must reduce cost: adjusted %v, total %v", data[KeyAdjustedTotalCost], data[KeyTotalCost])
+	}
+
+	if _, err := (ContextInput{}).NetOverhead(); err == nil {
+		t.Fatal("expected error when all overhead components are nil")
+	}
+}
+
+func TestTemplateFor(t *testing.T) {
+	template, err := TemplateFor(KeyTotalCost, KeyUnitYield)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ordered, err := template.GetOrderedNodes()
+	if err != nil {
+		t.Fatalf("template does not validate: %v", err)
+	}
+	if last := ordered[len(ordered)-1].Name(); last != KeyUnitYield {
+		t.Fatalf("last ordered node = %s, want %s", last, KeyUnitYield)
+	}
+
+	data, err := samplePeriodInputs()[0].Calc(template, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertResultClose(t, data, KeyTotalCost, 15.4, 1e-9)
+	AssertResultClose(t, data, KeyUnitYield, 0.14, 1e-9)
+
+	if _, err := TemplateFor(KeyTotalCost, "no_such_formula"); err == nil {
+		t.Fatal("expected error for unknown output")
+	}
+}
+
+func TestRatioNode_MarginRatio(t *testing.T) {
+	ratio := RatioNode("margin_ratio", KeyNetMargin, KeyTotalCost, 4)
+	if deps := ratio.Requires(); len(deps) != 2 || deps[0] != KeyNetMargin || deps[1] != KeyTotalCost {
+		t.Fatalf("unexpected deps %v", deps)
+	}
+
+	data, err := samplePeriodInputs()[0].Calc(NewCalcTemplate(ratio), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 0.112 / 15.4 = 0.0072727...
+	AssertResultClose(t, data, "margin_ratio", 0.0073, 0)
+
+	zero := RatioNode("zero_ratio", KeyNetMargin, "zero_denominator", 4)
+	template := NewCalcTemplate(zero, FormulaNode{
+		name: "zero_denominator",
+		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
+			return 0, nil
+		},
+	})
+	data, err = samplePeriodInputs()[0].Calc(template, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertResultClose(t, data, "zero_ratio", 0, 0)
+}
+
+func TestSortCacheKeys(t *testing.T) {
+	template := NewCalcTemplate(RatioNode("sort_cache_probe", KeyNetMargin, KeyTotalCost, 4))
+	if _, err := template.GetOrderedNodes(); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, key := range SortCacheKeys() {
+		if key == "sort_cache_probe;" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("ordering key missing from %v", SortCacheKeys())
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewTTLCache().WithClock(func() time.Time { return now })
+	cache.Set("short", 1, time.Second)
+	cache.Set("long", 2, time.Hour)
+	now = now.Add(time.Minute)
+	if keys := cache.Keys(); len(keys) != 1 || keys[0] != "long" {
+		t.Fatalf("keys after expiry = %v, want [long]", keys)
+	}
+}
+
+func TestChainAdapters_FallbackPerComponent(t *testing.T) {
+	fallbackCalls := 0
+	primary := func(m ContextInput) (q, p, v *OptionalFloat) {
+		return nil, m.ObservedP, m.ObservedV
+	}
+	fallback := func(m ContextInput) (q, p, v *OptionalFloat) {
+		fallbackCalls++
+		return m.AggregateQ, m.AggregateP, m.AggregateV
+	}
+	unused := func(m ContextInput) (q, p, v *OptionalFloat) {
+		t.Fatal("adapter after a complete result should not be called")
+		return nil, nil, nil
+	}
+
+	input := ContextInput{
+		ObservedP:  NewOptionalFloat(19.2),
+		ObservedV:  NewOptionalFloat(15.36),
+		AggregateQ: NewOptionalFloat(0.8),
+		AggregateP: NewOptionalFloat(20),
+	}
+	q, p, v := ChainAdapters(primary, fallback, unused)(input)
+	if q == nil || *q != 0.8 {
+		t.Errorf("Q = %v, want fallback 0.8", q)
+	}
+	if p == nil || *p != 19.2 {
+		t.Errorf("P = %v, primary value should win", p)
+	}
+	if v == nil || *v != 15.36 {
+		t.Errorf("V = %v, want 15.36", v)
+	}
+	if fallbackCalls != 1 {
+		t.Errorf("fallback called %d times, want 1", fallbackCalls)
+	}
+}
+
+func TestCalc_NodeComputeErrorPath(t *testing.T) {
+	failingYield := FormulaNode{
+		name: KeyUnitYield,
+		deps: []string{KeyNetMargin, KeyAggregateMetrics},
+		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
+			return 0, fmt.Errorf("yield backend unavailable")
+		},
+	}
+
+	_, err := samplePeriodInputs()[0].Calc(NewCalcTemplate(failingYield), false)
+	var computeErr *NodeComputeError
+	if !errors.As(err, &computeErr) {
+		t.Fatalf("expected *NodeComputeError, got %T: %v", err, err)
+	}
+	if computeErr.Node != KeyUnitYield {
+		t.Fatalf("failing node = %s", computeErr.Node)
+	}
+	want := []string{KeySettlementImpact, KeyScenarioMargin, KeyNetMargin, KeyUnitYield}
+	if !reflect.DeepEqual(computeErr.Path, want) {
+		t.Fatalf("path = %v, want %v", computeErr.Path, want)
+	}
+	if !strings.Contains(err.Error(), "node unit_yield compute failed: yield backend unavailable") {
+		t.Fatalf("unexpected message %q", err.Error())
+	}
+}
+
+func TestCalc_PeriodNode(t *testing.T) {
+	template := NewFullCalcTemplateWithOptions(FullTemplateOptions{IncludeSeasonalBaseCost: true})
+	if _, ok := NewFullCalcTemplate().registry[KeySeasonalBaseCost]; ok {
+		t.Fatal("seasonal base cost must be opt-in")
+	}
+
+	input := samplePeriodInputs()[2]
+	data, err := input.Calc(template, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertResultClose(t, data, KeyPeriod+".Q", 3, 0)
+	AssertResultClose(t, data, KeySeasonalBaseCost, 14.6664, 1e-9)
+
+	input = samplePeriodInputs()[0]
+	data, err = input.Calc(template, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertResultClose(t, data, KeySeasonalBaseCost, data[KeyBaseCost].(float64), 0)
+}
+
+func TestCalcTemplate_DisableNode(t *testing.T) {
+	template := NewFullCalcTemplate()
+	input := samplePeriodInputs()[0]
+
+	template.Disable(KeySettlementImpact)
+	_, err := input.Calc(template, false)
+	if !errors.Is(err, ErrDependencyDisabled) {
+		t.Fatalf("expected dependency disabled error, got %v", err)
+	}
+	var computeErr *NodeComputeError
+	if !errors.As(err, &computeErr) || computeErr.Node != KeyTotalCost {
+		t.Fatalf("expected total_cost to surface the error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "dependency disabled: settlement_impact") {
+		t.Fatalf("unexpected message %q", err.Error())
+	}
+
+	report, err := input.CalcReport(template, CalcOptions{SkipDisabledDependents: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSkipped := []string{KeySettlementImpact, KeyTotalCost, KeyNetMargin, KeyUnitYield}
+	if !reflect.DeepEqual(report.Skipped, wantSkipped) {
+		t.Fatalf("skipped = %v, want %v", report.Skipped, wantSkipped)
+	}
+	if _, ok := report.Results[KeySettlementImpact]; ok {
+		t.Fatal("disabled node must be absent from results")
+	}
+	AssertResultClose(t, report.Results, KeyBaseCost, 15.155, 1e-9)
+
+	template.Enable(KeySettlementImpact)
+	data, err := input.Calc(template, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertResultClose(t, data, KeyTotalCost, 15.4, 1e-9)
+}
+
+func TestFormulaNode_OptionalDeps(t *testing.T) {
+	var seen map[string]bool
+	node := OptionalFormulaNode(
+		"base_cost_with_overhead",
+		[]string{KeyBaseCost},
+		[]string{KeyOverheadAdjusters, "missing_optional_input"},
+		func(m ContextInput, prev map[string]interface{}, present map[string]bool) (float64, error) {
+			seen = present
+			base := prev[KeyBaseCost].(float64)
+			if !present[KeyOverheadAdjusters] {
+				return base, nil
+			}
+			overhead := prev[KeyOverheadAdjusters].(Result)
+			if overhead.V == nil {
+				return base, nil
+			}
+			return utils.DecimalAdd(base, float64(*overhead.V)), nil
+		},
+	)
+	template := NewCalcTemplate(node)
+
+	input := samplePeriodInputs()[0]
+	input.OverheadQ, input.OverheadP, input.OverheadV = nil, nil, nil
+	data, err := input.Calc(template, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertResultClose(t, data, "base_cost_with_overhead", 15.155, 1e-9)
+	if seen[KeyOverheadAdjusters] || seen["missing_optional_input"] {
+		t.Fatalf("present flags = %v, want none present", seen)
+	}
+
+	input.OverheadV = NewOptionalFloat(0.8)
+	data, err = input.Calc(template, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertResultClose(t, data, "base_cost_with_overhead", 15.955, 1e-9)
+	if !seen[KeyOverheadAdjusters] {
+		t.Fatalf("present flags = %v, want overhead present", seen)
+	}
+}
+
+func TestFormulaNode_OptionalDepsEmpty(t *testing.T) {
+	node := OptionalFormulaNode("no_optional", []string{KeyBaseCost}, nil,
+		func(_ ContextInput, prev map[string]interface{}, present map[string]bool) (float64, error) {
+			if len(present) != 0 {
+				return 0, fmt.Errorf("unexpected present flags %v", present)
+			}
+			return prev[KeyBaseCost].(float64), nil
+		})
+	if err := node.IsValid(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := samplePeriodInputs()[0].Calc(NewCalcTemplate(node), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertResultClose(t, data, "no_optional", 15.155, 1e-9)
+}
+
+func TestNewCalcTemplateChecked(t *testing.T) {
+	broken := FormulaNode{name: "no_closure", deps: []string{KeyBaseCost}}
+	if err := broken.IsValid(); err == nil || err.Error() != "formula no_closure has no computation function" {
+		t.Fatalf("IsValid() = %v", err)
+	}
+	if _, err := NewCalcTemplateChecked(broken); err == nil || !strings.Contains(err.Error(), "no_closure has no computation function") {
+		t.Fatalf("expected construction-time error, got %v", err)
+	}
+
+	if _, err := NewCalcTemplateChecked(RatioNode("checked_ratio", "no_such_dep", KeyBaseCost, 4)); err == nil || err.Error() != "unknown dependency: no_such_dep" {
+		t.Fatalf("expected unknown dependency error, got %v", err)
+	}
+
+	template, err := NewCalcTemplateChecked(currentRegistries().formulas[KeyUnitYield])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := samplePeriodInputs()[0].Calc(template, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCalc_TotalBudget(t *testing.T) {
+	slow := func(name string, deps ...string) FormulaNode {
+		return FormulaNode{name: name, deps: deps, formula: func(ContextInput, map[string]interface{}) (float64, error) {
+			time.Sleep(20 * time.Millisecond)
+			return 1, nil
+		}}
+	}
+	template := NewCalcTemplate(slow("slow_a"), slow("slow_b", "slow_a"), slow("slow_c", "slow_b"))
+
+	_, err := ContextInput{}.CalcWithOptions(template, CalcOptions{TotalBudget: 30 * time.Millisecond})
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("expected budget error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "budget exceeded after node slow_a") {
+		t.Fatalf("unexpected message %q", err.Error())
+	}
+
+	report, err := ContextInput{}.CalcReport(template, CalcOptions{TotalBudget: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Timings) != 3 {
+		t.Fatalf("timings = %v, want all three nodes", report.Timings)
+	}
+}
+
+func TestResult_Overlay(t *testing.T) {
+	onlyQ := Result{Q: NewOptionalFloat(1)}
+	pv := Result{P: NewOptionalFloat(2), V: NewOptionalFloat(3)}
+
+	merged := onlyQ.Overlay(pv)
+	if merged.Q == nil || merged.P == nil || merged.V == nil {
+		t.Fatalf("merged = %+v, want all components present", merged)
+	}
+	if *merged.Q != 1 || *merged.P != 2 || *merged.V != 3 {
+		t.Fatalf("merged = {%v, %v, %v}", *merged.Q, *merged.P, *merged.V)
+	}
+
+	conflict := Result{Q: NewOptionalFloat(1)}.Overlay(Result{Q: NewOptionalFloat(5)})
+	if *conflict.Q != 1 {
+		t.Fatalf("present component must win, got %v", *conflict.Q)
+	}
+	if onlyQ.P != nil {
+		t.Fatal("Overlay must not modify the receiver")
+	}
+}
+
+func TestEvalNode(t *testing.T) {
+	node := currentRegistries().formulas[KeyTotalCost]
+	got, err := EvalNode(node, ContextInput{}, map[string]interface{}{
+		KeyBaseCost:         15.155,
+		KeySettlementImpact: 0.245,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 15.4 {
+		t.Fatalf("total_cost = %v, want 15.4", got)
+	}
+
+	_, err = EvalNode(node, ContextInput{}, map[string]interface{}{KeyBaseCost: 15.155})
+	if err == nil || err.Error() != "missing dependencies for node total_cost: settlement_impact" {
+		t.Fatalf("expected missing dependency error, got %v", err)
+	}
+}
+
+func TestCalc_MissingAsNaN(t *testing.T) {
+	input := samplePeriodInputs()[0]
+	input.BaselineV = nil
+
+	if _, err := input.Calc(NewFullCalcTemplate(), false); err == nil {
+		t.Fatal("expected nil baseline to fail without MissingAsNaN")
+	}
+
+	data, err := input.CalcWithOptions(NewFullCalcTemplate(), CalcOptions{MissingAsNaN: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{KeyBaseCost, KeyTotalCost} {
+		if v, ok := data[key].(float64); !ok || !math.IsNaN(v) {
+			t.Errorf("%s = %v, want NaN", key, data[key])
+		}
+	}
+	AssertResultClose(t, data, KeySettlementImpact, 0.245, 1e-9)
+	AssertResultClose(t, data, KeyUnitYield, 0.14, 1e-9)
+	if input.BaselineV != nil {
+		t.Fatal("MissingAsNaN must not modify the caller's context")
+	}
+}
+
+func TestCalc_ResultStringFormatting(t *testing.T) {
+	noisy := math.Nextafter(15.36, 0)
+	if fmt.Sprintf("%v", noisy) == "15.36" {
+		t.Fatal("test value must carry float noise")
+	}
+	input := samplePeriodInputs()[0]
+	input.AggregateQ = NewOptionalFloat(noisy)
+	data, err := input.Calc(NewFullCalcTemplate(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := data[KeyAggregateMetrics].(string)
+	if !strings.HasPrefix(got, "{15.36, ") {
+		t.Fatalf("aggregate_metrics = %q, want Q rendered as 15.36", got)
+	}
+
+	// 精确格式需显式开启：超过 15 位有效数字的分量原样保留，而不是被规整掉。
+	defer func(places int) { ResultFormatPlaces = places }(ResultFormatPlaces)
+	ResultFormatPlaces = utils.PlacesExact
+	precise := 123456789.12345678
+	input.AggregateQ = NewOptionalFloat(precise)
+	data, err = input.Calc(NewFullCalcTemplate(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = data[KeyAggregateMetrics].(string)
+	if !strings.HasPrefix(got, "{123456789.12345678, ") {
+		t.Fatalf("aggregate_metrics = %q, want Q rendered with full precision", got)
+	}
+	if v, err := ResultValue(data, KeyAggregateMetrics+".Q"); err != nil || v != precise {
+		t.Fatalf("ResultValue round trip = %v, %v; want %v", v, err, precise)
+	}
+}
+
+func TestCalc_ResultFormatPlaces(t *testing.T) {
+	defer func(places int) { ResultFormatPlaces = places }(ResultFormatPlaces)
+	ResultFormatPlaces = 2
+
+	input := samplePeriodInputs()[0]
+	input.OverheadQ = NewOptionalFloat(10)
+	input.OverheadP = nil
+	input.OverheadV = NewOptionalFloat(5)
+	template := NewCalcTemplate(currentRegistries().inputs[KeyOverheadAdjusters], currentRegistries().inputs[KeyObservedMetrics])
+	data, err := input.Calc(template, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := data[KeyOverheadAdjusters]; got != "{10.00, <nil>, 5.00}" {
+		t.Fatalf("overhead_adjusters = %v, want {10.00, <nil>, 5.00}", got)
+	}
+	if got := data[KeyObservedMetrics]; got != "{0.80, 19.20, 15.36}" {
+		t.Fatalf("observed_metrics = %v, want {0.80, 19.20, 15.36}", got)
+	}
+	if v, err := ResultValue(data, KeyOverheadAdjusters+".V"); err != nil || v != 5 {
+		t.Fatalf("ResultValue on fixed-precision string = %v, %v", v, err)
+	}
+}
+
+func TestTTLCache_LRUEviction(t *testing.T) {
+	cache := NewTTLCacheWithCapacity(2)
+	cache.Set("a", 1, time.Hour)
+	cache.Set("b", 2, time.Hour)
+	if _, ok := cache.Get("a"); !ok {
+		t.Fatal("a should be cached")
+	}
+	cache.Set("c", 3, time.Hour)
+
+	if _, ok := cache.Get("b"); ok {
+		t.Fatal("least recently used key b should have been evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Fatalf("%s should survive eviction", key)
+		}
+	}
+	if keys := cache.Keys(); !reflect.DeepEqual(keys, []string{"a", "c"}) {
+		t.Fatalf("Keys() = %v", keys)
+	}
+
+	cache.Set("a", 10, time.Hour)
+	cache.Set("d", 4, time.Hour)
+	if v, ok := cache.Get("a"); !ok || v != 10 {
+		t.Fatalf("updated key a = %v, %v", v, ok)
+	}
+	if _, ok := cache.Get("c"); ok {
+		t.Fatal("c should have been evicted after a was refreshed")
+	}
+}
+
+func TestBreakEvenQuantity(t *testing.T) {
+	if got, err := BreakEvenQuantity(100, 0.3); err != nil || got != 333.3333 {
+		t.Fatalf("BreakEvenQuantity(100, 0.3) = %v, %v", got, err)
+	}
+	if _, err := BreakEvenQuantity(100, 0); err == nil || !strings.Contains(err.Error(), "unit margin is zero") {
+		t.Fatalf("expected zero-margin error, got %v", err)
+	}
+	if _, err := BreakEvenQuantity(100, -1); err == nil {
+		t.Fatal("expected negative-margin error")
+	}
+
+	template, err := TemplateFor(KeyBreakEven)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := samplePeriodInputs()[0].Calc(template, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// overhead_total 0.8 / unit_yield 0.14。
+	AssertResultClose(t, data, KeyBreakEven, 5.7143, 1e-9)
+	if warnings := template.CheckUnits(); len(warnings) != 0 {
+		t.Fatalf("unexpected unit warnings %v", warnings)
+	}
+}
+
+func TestSettlementImpactElastic(t *testing.T) {
+	template := NewFullCalcTemplateWithOptions(FullTemplateOptions{IncludeElasticSettlement: true})
+	if _, ok := NewFullCalcTemplate().registry[KeySettlementImpactElastic]; ok {
+		t.Fatal("elastic settlement must be opt-in")
+	}
+
+	for _, tc := range []struct {
+		elasticity string
+		want       float64
+	}{
+		{"", 0.245},
+		{"1.0", 0.245},
+		{"0.5", 0.1225},
+	} {
+		input := samplePeriodInputs()[0]
+		if tc.elasticity != "" {
+			input.Meta = map[string]string{"elasticity": tc.elasticity}
+		}
+		data, err := input.Calc(template, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		AssertResultClose(t, data, KeySettlementImpact, 0.245, 0)
+		AssertResultClose(t, data, KeySettlementImpactElastic, tc.want, 0)
+	}
+
+	input := samplePeriodInputs()[0]
+	input.Meta = map[string]string{"elasticity": "high"}
+	if _, err := input.Calc(template, false); err == nil {
+		t.Fatal("expected error for invalid elasticity")
+	}
+}
+
+func TestSettlementImpactElastic_SharedNodeCache(t *testing.T) {
+	template := NewFullCalcTemplateWithOptions(FullTemplateOptions{IncludeElasticSettlement: true})
+	opts := CalcOptions{NodeCache: NewTTLCache()}
+
+	for _, tc := range []struct {
+		elasticity string
+		want       float64
+	}{
+		{"1", 0.245},
+		{"0.5", 0.1225},
+	} {
+		input := samplePeriodInputs()[0]
+		input.Meta = map[string]string{"elasticity": tc.elasticity}
+		data, err := input.CalcWithOptions(template, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		AssertResultClose(t, data, KeySettlementImpactElastic, tc.want, 0)
+	}
+}
+
+func TestCalcSelected(t *testing.T) {
+	odd, err := TemplateFor(KeyBaseCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	even, err := TemplateFor(KeySettlementImpact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byParity := func(m ContextInput) *CalcTemplate {
+		if m.Period%2 == 0 {
+			return even
+		}
+		return odd
+	}
+
+	for _, input := range samplePeriodInputs()[:2] {
+		data, err := CalcSelected(byParity, input, CalcOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, unwanted := KeyBaseCost, KeySettlementImpact
+		if input.Period%2 == 0 {
+			want, unwanted = unwanted, want
+		}
+		if _, ok := data[want]; !ok {
+			t.Errorf("period %d: missing %s in %v", input.Period, want, data)
+		}
+		if _, ok := data[unwanted]; ok {
+			t.Errorf("period %d: unexpected %s in %v", input.Period, unwanted, data)
+		}
+	}
+
+	none := func(ContextInput) *CalcTemplate { return nil }
+	if _, err := CalcSelected(none, samplePeriodInputs()[0], CalcOptions{}); err == nil {
+		t.Fatal("expected error when no template is selected")
+	}
+}
+
+func TestCalc_PooledRunDoesNotLeakState(t *testing.T) {
+	full := NewFullCalcTemplate().
+		WithParams(map[string]float64{ParamAggregateAdjustment: 0}).
+		WithZeroDenominatorPolicy(ZeroDenominatorNaN)
+	small := NewCalcTemplate(FormulaNode{
+		name: "constant",
+		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
+			return 1, nil
+		},
+	})
+	input := samplePeriodInputs()[0]
+
+	for i := 0; i < 20; i++ {
+		first, err := input.Calc(full, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		emitted := len(first)
+
+		run, err := input.evaluate(small, CalcOptions{}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(run.done) != 1 || run.done["constant"] != 1.0 {
+			t.Fatalf("pooled done leaked state: %v", run.done)
+		}
+		if _, ok := run.statuses["constant"]; len(run.statuses) != 1 || !ok || len(run.order) != 1 {
+			t.Fatalf("pooled run leaked statuses %v or order %v", run.statuses, run.order)
+		}
+		run.release()
+
+		if _, err := input.Calc(small, false); err != nil {
+			t.Fatal(err)
+		}
+		if len(first) != emitted {
+			t.Fatalf("returned results changed after later run: %v", first)
+		}
+	}
+}
+
+// BenchmarkCalc 对比 Calc（calcRun 取自池并归还）与不归还的原有路径，-benchmem 可见每次计算的分配差异。
+func BenchmarkCalc(b *testing.B) {
+	template := NewFullCalcTemplate()
+	input := samplePeriodInputs()[0]
+
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := input.Calc(template, false); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("unpooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := input.evaluate(template, CalcOptions{}, false); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestEmptyInputResult(t *testing.T) {
+	preserveRegistries(t)
+	RegisterInputAdapter("empty_adapter", func(ContextInput) (q, p, v *OptionalFloat) {
+		return nil, nil, nil
+	})
+
+	node, _ := lookupRegistered("empty_adapter")
+	res, err := node.Compute(ContextInput{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, ok := res.(Result); !ok || !r.IsEmpty() || r != EmptyResult {
+		t.Fatalf("all-nil adapter produced %#v, want EmptyResult", res)
+	}
+	if (Result{V: NewOptionalFloat(0)}).IsEmpty() {
+		t.Fatal("result with a present zero component is not empty")
+	}
+
+	template := NewCalcTemplate(FormulaNode{
+		name: "uses_empty",
+		deps: []string{"empty_adapter"},
+		formula: func(ContextInput, map[string]interface{}) (float64, error) {
+			return 1, nil
+		},
+	})
+	if _, err := (ContextInput{}).CalcWithOptions(template, CalcOptions{}); err != nil {
+		t.Fatalf("empty input must be allowed by default: %v", err)
+	}
+	_, err = (ContextInput{}).CalcWithOptions(template, CalcOptions{RejectEmptyInputs: true})
+	if !errors.Is(err, ErrEmptyInput) {
+		t.Fatalf("expected ErrEmptyInput, got %v", err)
+	}
+}
+
+func TestCalc_DivideByZeroModeKeepsZeroProducts(t *testing.T) {
+	defer utils.SetDivideByZeroMode(utils.SetDivideByZeroMode(utils.ReturnNaN))
+
+	// 两个场景价格相同时价差为零，乘积为精确的零，不得因零除模式变为 NaN。
+	input := samplePeriodInputs()[0]
+	input.ScenarioBP = input.ScenarioAP
+	data, err := input.Calc(NewFullCalcTemplate(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range data {
+		if f, ok := value.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+			t.Errorf("%s = %v, want a finite value", key, f)
+		}
+	}
 }
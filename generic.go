@@ -0,0 +1,40 @@
+package dynamicformula
+
+import "fmt"
+
+// GenericFormulaNode 是输出类型为 T 的公式节点，适用于一次产出多个派生值等 float64 无法表达的结果。
+// 下游节点通过 PrevTyped 按类型读取其结果。
+type GenericFormulaNode[T any] struct {
+	name    string
+	deps    []string
+	formula func(ContextInput, map[string]interface{}) (T, error)
+}
+
+// NewGenericFormulaNode 构造输出类型为 T 的公式节点。
+func NewGenericFormulaNode[T any](name string, deps []string, fn func(m ContextInput, prev map[string]interface{}) (T, error)) GenericFormulaNode[T] {
+	return GenericFormulaNode[T]{name: name, deps: deps, formula: fn}
+}
+
+func (n GenericFormulaNode[T]) Name() string { return n.name }
+
+func (GenericFormulaNode[T]) formulaOutput() {}
+
+func (n GenericFormulaNode[T]) Requires() []string { return n.deps }
+
+func (n GenericFormulaNode[T]) Compute(m ContextInput, done map[string]interface{}) (interface{}, error) {
+	return n.formula(m, done)
+}
+
+// PrevTyped 按类型 T 读取依赖结果，依赖缺失或类型不符时返回错误。
+func PrevTyped[T any](prev map[string]interface{}, name string) (T, error) {
+	var zero T
+	raw, ok := prev[name]
+	if !ok {
+		return zero, fmt.Errorf("dependency %s is unavailable", name)
+	}
+	value, ok := raw.(T)
+	if !ok {
+		return zero, fmt.Errorf("dependency %s has type %T, want %T", name, raw, zero)
+	}
+	return value, nil
+}
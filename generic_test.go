@@ -0,0 +1,51 @@
+package dynamicformula
+
+import (
+	"testing"
+
+	"github.com/force-c/dynamic-formula/utils"
+)
+
+type costSplit struct {
+	Fixed    float64
+	Variable float64
+}
+
+func TestGenericFormulaNode(t *testing.T) {
+	split := NewGenericFormulaNode("cost_split", []string{KeyBaseCost, KeySettlementImpact},
+		func(_ ContextInput, prev map[string]interface{}) (costSplit, error) {
+			base, err := PrevTyped[float64](prev, KeyBaseCost)
+			if err != nil {
+				return costSplit{}, err
+			}
+			settlement, err := PrevTyped[float64](prev, KeySettlementImpact)
+			if err != nil {
+				return costSplit{}, err
+			}
+			return costSplit{Fixed: base, Variable: settlement}, nil
+		})
+	share := NewGenericFormulaNode("variable_share", []string{"cost_split"},
+		func(_ ContextInput, prev map[string]interface{}) (float64, error) {
+			s, err := PrevTyped[costSplit](prev, "cost_split")
+			if err != nil {
+				return 0, err
+			}
+			return utils.DecimalDivide(s.Variable, utils.DecimalAdd(s.Fixed, s.Variable), 4), nil
+		})
+
+	data, err := samplePeriodInputs()[0].Calc(NewCalcTemplate(split, share), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := data["cost_split"].(costSplit); got != (costSplit{Fixed: 15.155, Variable: 0.245}) {
+		t.Fatalf("cost_split = %+v", got)
+	}
+	AssertResultClose(t, data, "variable_share", 0.0159, 1e-9)
+
+	if _, err := PrevTyped[costSplit](data, "variable_share"); err == nil {
+		t.Fatal("expected type mismatch error")
+	}
+	if _, err := PrevTyped[float64](data, "missing"); err == nil {
+		t.Fatal("expected missing dependency error")
+	}
+}
@@ -0,0 +1,57 @@
+package dynamicformula
+
+import "sync"
+
+// History 是节点最近若干次计算结果的环形缓冲，跨多次 Calc 保留，可并发读取。
+type History struct {
+	mutex  sync.Mutex
+	values []interface{}
+	next   int
+	full   bool
+}
+
+// Recent 按从旧到新的顺序返回保留的结果。
+func (h *History) Recent() []interface{} {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if !h.full {
+		return append([]interface{}(nil), h.values[:h.next]...)
+	}
+	recent := make([]interface{}, 0, len(h.values))
+	recent = append(recent, h.values[h.next:]...)
+	return append(recent, h.values[:h.next]...)
+}
+
+func (h *History) record(v interface{}) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.values[h.next] = v
+	h.next++
+	if h.next == len(h.values) {
+		h.next = 0
+		h.full = true
+	}
+}
+
+type historyNode struct {
+	Node
+	history *History
+}
+
+func (n historyNode) Compute(m ContextInput, done map[string]interface{}) (interface{}, error) {
+	res, err := n.Node.Compute(m, done)
+	if err != nil {
+		return nil, err
+	}
+	n.history.record(res)
+	return res, nil
+}
+
+// WithHistory 包装节点，使其每次成功计算的结果写入容量为 size 的 History。
+func WithHistory(n Node, size int) (Node, *History) {
+	if size < 1 {
+		size = 1
+	}
+	h := &History{values: make([]interface{}, size)}
+	return historyNode{Node: n, history: h}, h
+}
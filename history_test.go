@@ -0,0 +1,76 @@
+package dynamicformula
+
+import "testing"
+
+func TestWithHistory_KeepsLastN(t *testing.T) {
+	node, history := WithHistory(currentRegistries().formulas[KeyBaseCost], 2)
+	template := NewCalcTemplate(node)
+
+	for _, baseline := range []float64{1, 2, 3} {
+		input := ContextInput{
+			BaselineV:  NewOptionalFloat(baseline),
+			ScenarioAV: NewOptionalFloat(10),
+			ScenarioBV: NewOptionalFloat(20),
+		}
+		data, err := input.Calc(template, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := data[KeyBaseCost]; !ok {
+			t.Fatalf("decorated node missing from results: %v", data)
+		}
+	}
+
+	recent := history.Recent()
+	if len(recent) != 2 || recent[0] != 32.0 || recent[1] != 33.0 {
+		t.Fatalf("history = %v, want [32 33]", recent)
+	}
+}
+
+// constantNode 是包外调用方可能实现的最小 Node。
+type constantNode struct{ name string }
+
+func (n constantNode) Name() string { return n.name }
+
+func (n constantNode) Requires() []string { return nil }
+
+func (n constantNode) Compute(ContextInput, map[string]interface{}) (interface{}, error) {
+	return 7.0, nil
+}
+
+func TestCalc_EmitRuleForCustomAndDecoratedNodes(t *testing.T) {
+	custom, _ := WithHistory(constantNode{name: "custom_constant"}, 1)
+	template := NewCalcTemplate(constantNode{name: "plain_constant"}, custom)
+
+	data, err := ContextInput{}.Calc(template, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 0 {
+		t.Fatalf("custom nodes must only be emitted with includeInputNodes, got %v", data)
+	}
+	data, err = ContextInput{}.Calc(template, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["plain_constant"] != 7.0 || data["custom_constant"] != 7.0 {
+		t.Fatalf("includeInputNodes results = %v", data)
+	}
+}
+
+func TestWithHistory_SortCacheUsesOwnNodes(t *testing.T) {
+	base := currentRegistries().formulas[KeyBaseCost]
+	wrapped, history := WithHistory(base, 4)
+	input := samplePeriodInputs()[0]
+
+	// 两个模板的排序缓存键相同，缓存只保存节点名，后者必须执行自己的装饰节点而不是前者的普通节点。
+	if _, err := input.Calc(NewCalcTemplate(base), false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := input.Calc(NewCalcTemplate(wrapped), false); err != nil {
+		t.Fatal(err)
+	}
+	if recent := history.Recent(); len(recent) != 1 {
+		t.Fatalf("history = %v, want one recorded result", recent)
+	}
+}
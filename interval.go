@@ -0,0 +1,139 @@
+package dynamicformula
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/force-c/dynamic-formula/utils"
+)
+
+// Interval 是闭区间 [Lo, Hi]，用于在公式间传播取值的上下界。
+type Interval struct {
+	Lo, Hi float64
+}
+
+// PointInterval 返回退化为单点的区间。
+func PointInterval(x float64) Interval {
+	return Interval{Lo: x, Hi: x}
+}
+
+// IntervalAdd 返回 [a.Lo+b.Lo, a.Hi+b.Hi]。
+func IntervalAdd(a, b Interval) Interval {
+	return Interval{Lo: utils.DecimalAdd(a.Lo, b.Lo), Hi: utils.DecimalAdd(a.Hi, b.Hi)}
+}
+
+// IntervalSub 返回 [a.Lo-b.Hi, a.Hi-b.Lo]。
+func IntervalSub(a, b Interval) Interval {
+	return Interval{Lo: utils.DecimalSubtract(a.Lo, b.Hi), Hi: utils.DecimalSubtract(a.Hi, b.Lo)}
+}
+
+// IntervalMul 返回四个端点乘积中的最小值与最大值构成的区间。
+func IntervalMul(a, b Interval) Interval {
+	products := []float64{
+		utils.DecimalMul(a.Lo, b.Lo),
+		utils.DecimalMul(a.Lo, b.Hi),
+		utils.DecimalMul(a.Hi, b.Lo),
+		utils.DecimalMul(a.Hi, b.Hi),
+	}
+	lo, hi := products[0], products[0]
+	for _, p := range products[1:] {
+		lo = math.Min(lo, p)
+		hi = math.Max(hi, p)
+	}
+	return Interval{Lo: lo, Hi: hi}
+}
+
+// IntervalDiv 返回 a × [1/b.Hi, 1/b.Lo]，按 places 位小数计算倒数；除数区间包含 0 时结果无界，返回错误。
+func IntervalDiv(a, b Interval, places int) (Interval, error) {
+	if b.Lo <= 0 && b.Hi >= 0 {
+		return Interval{}, fmt.Errorf("interval division by [%v, %v] which contains zero", b.Lo, b.Hi)
+	}
+	reciprocal := Interval{Lo: utils.DecimalDivide(1, b.Hi, places), Hi: utils.DecimalDivide(1, b.Lo, places)}
+	return IntervalMul(a, reciprocal), nil
+}
+
+// IntervalResult 是 Result 的区间版本，nil 分量表示缺失。
+type IntervalResult struct {
+	Q, P, V *Interval
+}
+
+// intervalInputNode 把已注册输入节点的点值按相对误差扩展为区间。
+type intervalInputNode struct {
+	name   string
+	point  Node
+	spread float64
+}
+
+func (n intervalInputNode) Name() string { return n.name }
+
+func (n intervalInputNode) Requires() []string { return nil }
+
+func (n intervalInputNode) Compute(m ContextInput, done map[string]interface{}) (interface{}, error) {
+	res, err := n.point.Compute(m, done)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := res.(Result)
+	if !ok {
+		return nil, fmt.Errorf("input node %s returned %T, want Result", n.name, res)
+	}
+	widen := func(f *OptionalFloat) *Interval {
+		if f == nil {
+			return nil
+		}
+		delta := utils.DecimalMul(math.Abs(float64(*f)), n.spread)
+		return &Interval{Lo: utils.DecimalSubtract(float64(*f), delta), Hi: utils.DecimalAdd(float64(*f), delta)}
+	}
+	return IntervalResult{Q: widen(r.Q), P: widen(r.P), V: widen(r.V)}, nil
+}
+
+// IntervalInputNode 返回与已注册输入节点同名的区间输入节点：各分量按 ±spread 的相对误差扩展为区间，
+// 例如 spread 为 0.05 时 100 扩展为 [95, 105]。作为显式节点传入模板即可覆盖同名的点值输入。
+func IntervalInputNode(name string, spread float64) (Node, error) {
+	if spread < 0 {
+		return nil, fmt.Errorf("interval spread must not be negative, got %v", spread)
+	}
+	point, ok := currentRegistries().inputs[name]
+	if !ok {
+		return nil, fmt.Errorf("input node %s not registered", name)
+	}
+	return intervalInputNode{name: name, point: point, spread: spread}, nil
+}
+
+// intervalFormulaNode 是输出 Interval 的公式节点。
+type intervalFormulaNode struct {
+	name    string
+	deps    []string
+	formula func(ContextInput, map[string]interface{}) (Interval, error)
+}
+
+func (n intervalFormulaNode) Name() string { return n.name }
+
+func (intervalFormulaNode) formulaOutput() {}
+
+func (n intervalFormulaNode) Requires() []string { return n.deps }
+
+func (n intervalFormulaNode) Compute(m ContextInput, done map[string]interface{}) (interface{}, error) {
+	return n.formula(m, done)
+}
+
+// IntervalFormulaNode 构建输出 Interval 的公式节点，依赖可以是 Interval 或 IntervalResult。
+func IntervalFormulaNode(name string, deps []string, fn func(m ContextInput, prev map[string]interface{}) (Interval, error)) Node {
+	return intervalFormulaNode{name: name, deps: deps, formula: fn}
+}
+
+// IntervalBaseCostNode 返回 base_cost 的区间版本：基线、场景 A、场景 B 估值区间之和。
+func IntervalBaseCostNode() Node {
+	deps := []string{KeyBaselineMetrics, KeyScenarioAInputs, KeyScenarioBInputs}
+	return IntervalFormulaNode(KeyBaseCost, deps, func(m ContextInput, prev map[string]interface{}) (Interval, error) {
+		var sum Interval
+		for _, dep := range deps {
+			r, ok := prev[dep].(IntervalResult)
+			if !ok || r.V == nil {
+				return Interval{}, fmt.Errorf("invalid %s interval data", dep)
+			}
+			sum = IntervalAdd(sum, *r.V)
+		}
+		return sum, nil
+	})
+}
@@ -0,0 +1,58 @@
+package dynamicformula
+
+import "testing"
+
+func TestIntervalArithmetic(t *testing.T) {
+	a := Interval{Lo: 1, Hi: 2}
+	b := Interval{Lo: -3, Hi: 4}
+	if got := IntervalAdd(a, b); got != (Interval{Lo: -2, Hi: 6}) {
+		t.Errorf("IntervalAdd = %v", got)
+	}
+	if got := IntervalSub(a, b); got != (Interval{Lo: -3, Hi: 5}) {
+		t.Errorf("IntervalSub = %v", got)
+	}
+	if got := IntervalMul(a, b); got != (Interval{Lo: -6, Hi: 8}) {
+		t.Errorf("IntervalMul = %v", got)
+	}
+	if got, err := IntervalDiv(a, Interval{Lo: 2, Hi: 4}, 4); err != nil || got != (Interval{Lo: 0.25, Hi: 1}) {
+		t.Errorf("IntervalDiv = %v, %v", got, err)
+	}
+	if got := IntervalMul(a, PointInterval(-1)); got != (Interval{Lo: -2, Hi: -1}) {
+		t.Errorf("IntervalMul by point = %v", got)
+	}
+	if _, err := IntervalDiv(a, b, 4); err == nil {
+		t.Error("expected error when divisor interval contains zero")
+	}
+}
+
+func TestIntervalBaseCost(t *testing.T) {
+	nodes := []Node{IntervalBaseCostNode()}
+	for _, name := range []string{KeyBaselineMetrics, KeyScenarioAInputs, KeyScenarioBInputs} {
+		n, err := IntervalInputNode(name, 0.1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes = append(nodes, n)
+	}
+	template := NewCalcTemplate(nodes...)
+
+	data, err := samplePeriodInputs()[0].Calc(template, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 点值 4.3 + 4.625 + 6.23 = 15.155，±10% 为 [13.6395, 16.6705]。
+	got, ok := data[KeyBaseCost].(Interval)
+	if !ok {
+		t.Fatalf("base_cost = %T %v, want Interval", data[KeyBaseCost], data[KeyBaseCost])
+	}
+	if got != (Interval{Lo: 13.6395, Hi: 16.6705}) {
+		t.Fatalf("base_cost = %v, want [13.6395, 16.6705]", got)
+	}
+	if _, ok := data[KeyBaselineMetrics]; ok {
+		t.Fatal("interval inputs must be treated as input nodes")
+	}
+
+	if _, err := IntervalInputNode("no_such_input", 0.1); err == nil {
+		t.Fatal("expected error for unknown input")
+	}
+}
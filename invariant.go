@@ -0,0 +1,70 @@
+package dynamicformula
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/force-c/dynamic-formula/utils"
+)
+
+// InvariantTotalCostSum 是完整模板内置的不变量：total_cost 必须精确等于 base_cost + settlement_impact。
+const InvariantTotalCostSum = "total_cost_sum"
+
+// invariant 是在计算结束后执行的具名结果校验。
+type invariant struct {
+	name  string
+	check func(results map[string]interface{}) error
+}
+
+// AddInvariant 注册计算结束后执行的结果不变量。check 收到的是各节点未经舍入的原始结果，
+// 任一不变量不成立时 Calc 返回汇总后的错误。
+func (t *CalcTemplate) AddInvariant(name string, check func(results map[string]interface{}) error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.invariants = append(t.invariants, invariant{name: name, check: check})
+}
+
+// resultInvariants 返回已注册不变量的副本。
+func (t *CalcTemplate) resultInvariants() []invariant {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return append([]invariant(nil), t.invariants...)
+}
+
+// checkInvariants 依次执行全部不变量，并以 errors.Join 汇总违反的结果。
+func (t *CalcTemplate) checkInvariants(results map[string]interface{}) error {
+	var errs []error
+	for _, inv := range t.resultInvariants() {
+		if err := inv.check(results); err != nil {
+			errs = append(errs, fmt.Errorf("invariant %s violated: %w", inv.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkTotalCostSum 校验 total_cost = base_cost + settlement_impact。任一值缺失（如被停用）
+// 或非有限数时跳过，避免与其他机制重复报错。
+func checkTotalCostSum(results map[string]interface{}) error {
+	total, ok := results[KeyTotalCost].(float64)
+	if !ok {
+		return nil
+	}
+	base, ok := results[KeyBaseCost].(float64)
+	if !ok {
+		return nil
+	}
+	settlement, ok := results[KeySettlementImpact].(float64)
+	if !ok {
+		return nil
+	}
+	for _, v := range []float64{total, base, settlement} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil
+		}
+	}
+	if want := utils.DecimalAdd(base, settlement); total != want {
+		return fmt.Errorf("%s %v != %s %v + %s %v", KeyTotalCost, total, KeyBaseCost, base, KeySettlementImpact, settlement)
+	}
+	return nil
+}
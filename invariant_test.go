@@ -0,0 +1,58 @@
+package dynamicformula
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/force-c/dynamic-formula/utils"
+)
+
+func TestFullTemplate_TotalCostInvariant(t *testing.T) {
+	input := samplePeriodInputs()[0]
+	if _, err := input.Calc(NewFullCalcTemplate(), false); err != nil {
+		t.Fatalf("consistent total_cost: %v", err)
+	}
+
+	preserveRegistries(t)
+	RegisterFormula(FormulaNode{
+		name: KeyTotalCost,
+		Unit: UnitValue,
+		deps: []string{KeyBaseCost, KeySettlementImpact},
+		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
+			return utils.DecimalAdd(prev[KeyBaseCost].(float64), prev[KeySettlementImpact].(float64), 0.01), nil
+		},
+	})
+
+	results, err := input.Calc(NewFullCalcTemplate(), false)
+	if err == nil || !strings.Contains(err.Error(), "invariant "+InvariantTotalCostSum+" violated") {
+		t.Fatalf("expected total_cost invariant violation, got %v", err)
+	}
+	if results != nil {
+		t.Fatalf("expected no results, got %v", results)
+	}
+}
+
+func TestCalcTemplate_AddInvariant(t *testing.T) {
+	errNegative := errors.New("base cost must not be negative")
+	template, err := TemplateFor(KeyBaseCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.AddInvariant("base_cost_positive", func(results map[string]interface{}) error {
+		if v, ok := results[KeyBaseCost].(float64); ok && v < 0 {
+			return fmt.Errorf("%w: %v", errNegative, v)
+		}
+		return nil
+	})
+
+	input := samplePeriodInputs()[0]
+	if _, err := input.Calc(template, false); err != nil {
+		t.Fatal(err)
+	}
+	input.BaselineV = NewOptionalFloat(-100)
+	if _, err := input.Calc(template, false); !errors.Is(err, errNegative) {
+		t.Fatalf("expected invariant error, got %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package dynamicformula
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/force-c/dynamic-formula/utils"
+)
+
+// contextInputJSON 与 ContextInput 字段一致，用于绕开自定义 MarshalJSON 的递归调用。
+type contextInputJSON ContextInput
+
+// MarshalJSON 以字段名输出上下文，缺失的可选值输出为 null，存在的零值输出为 0。
+func (m ContextInput) MarshalJSON() ([]byte, error) {
+	return json.Marshal(contextInputJSON(m))
+}
+
+// ParseContextInput 从 JSON 解析上下文：null 或缺省字段映射为 nil，数字映射为存在的值。
+// 未知字段视为错误，避免拼写错误的字段被静默忽略。
+func ParseContextInput(data []byte) (ContextInput, error) {
+	var raw contextInputJSON
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&raw); err != nil {
+		return ContextInput{}, fmt.Errorf("parse context input: %w", err)
+	}
+	return ContextInput(raw), nil
+}
+
+// EncodeResultsStream 逐期计算并把每期结果作为 JSON 数组元素增量写出，内存占用与输入条数无关。
+// 某期计算失败时返回错误，此前已写出的内容不保证是完整的 JSON。
+func EncodeResultsStream(w io.Writer, t *CalcTemplate, inputs []ContextInput, opts CalcOptions) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	for i, input := range inputs {
+		results, err := input.CalcWithOptions(t, opts)
+		if err != nil {
+			return fmt.Errorf("period %d (index %d): %w", input.Period, i, err)
+		}
+		data, err := json.Marshal(results)
+		if err != nil {
+			return fmt.Errorf("period %d (index %d): encode results: %w", input.Period, i, err)
+		}
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "]")
+	return err
+}
+
+// MarshalResultsJSON 把结果序列化为 JSON，数值经 utils.FormatDecimal 转为十进制并保留 places 位小数后以原样的 JSON 数字写出，
+// 避免 24.700000000000003 这类二进制浮点噪声：-1 输出去噪后的最短形式（24.7），utils.PlacesExact 输出不做舍入的精确形式，
+// 取值规则同 ResultFormatPlaces。Result 输出为 {"Q":…,"P":…,"V":…}，
+// 缺失分量为 null；其他类型按 encoding/json 默认规则输出。NaN 与 ±Inf 无法表示为 JSON 数字，返回错误。
+func MarshalResultsJSON(results map[string]interface{}, places int) ([]byte, error) {
+	encoded := make(map[string]interface{}, len(results))
+	for key, value := range results {
+		switch v := value.(type) {
+		case float64:
+			number, err := jsonDecimal(v, places)
+			if err != nil {
+				return nil, fmt.Errorf("marshal results: %s: %w", key, err)
+			}
+			encoded[key] = number
+		case Result:
+			components := make(map[string]json.RawMessage, 3)
+			for name, f := range map[string]*OptionalFloat{"Q": v.Q, "P": v.P, "V": v.V} {
+				if f == nil {
+					components[name] = json.RawMessage("null")
+					continue
+				}
+				number, err := jsonDecimal(float64(*f), places)
+				if err != nil {
+					return nil, fmt.Errorf("marshal results: %s.%s: %w", key, name, err)
+				}
+				components[name] = number
+			}
+			encoded[key] = components
+		default:
+			encoded[key] = value
+		}
+	}
+	return json.Marshal(encoded)
+}
+
+// jsonDecimal 把数值格式化为十进制 JSON 数字。
+func jsonDecimal(value float64, places int) (json.RawMessage, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, fmt.Errorf("non-finite value %v", value)
+	}
+	return json.RawMessage(utils.FormatDecimal(value, places)), nil
+}
+
+// recordedRun 是 RecordRun 写出的调试快照格式。
+type recordedRun struct {
+	Input        json.RawMessage `json:"input"`
+	TemplateHash string          `json:"template_hash"`
+	Nodes        []string        `json:"nodes"`
+}
+
+// RecordRun 把输入上下文、模板结构哈希与模板输出节点名写为一条 JSON，用于事后复现计算。
+func RecordRun(w io.Writer, m ContextInput, t *CalcTemplate) error {
+	input, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("record run: encode input: %w", err)
+	}
+	nodes := make([]string, len(t.nodes))
+	for i, n := range t.nodes {
+		nodes[i] = n.Name()
+	}
+	return json.NewEncoder(w).Encode(recordedRun{
+		Input:        input,
+		TemplateHash: t.StructuralHash(),
+		Nodes:        nodes,
+	})
+}
+
+// ReplayRun 读取 RecordRun 的输出，返回输入上下文、输出节点名与记录时的模板结构哈希。
+// 调用方可用 TemplateFor(nodes...) 基于当前注册表重建模板，并比较结构哈希判断公式图是否已变化。
+func ReplayRun(r io.Reader) (ContextInput, []string, string, error) {
+	var run recordedRun
+	if err := json.NewDecoder(r).Decode(&run); err != nil {
+		return ContextInput{}, nil, "", fmt.Errorf("replay run: %w", err)
+	}
+	input, err := ParseContextInput(run.Input)
+	if err != nil {
+		return ContextInput{}, nil, "", fmt.Errorf("replay run: %w", err)
+	}
+	return input, run.Nodes, run.TemplateHash, nil
+}
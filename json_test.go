@@ -0,0 +1,168 @@
+package dynamicformula
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/force-c/dynamic-formula/utils"
+)
+
+func TestContextInputJSON_RoundTrip(t *testing.T) {
+	input := ContextInput{
+		Period:     2,
+		ObservedQ:  NewOptionalFloat(0),
+		ObservedP:  NewOptionalFloat(20.5),
+		BaselineV:  NewOptionalFloat(6.6),
+		ScenarioAP: NewOptionalFloat(0),
+	}
+
+	data, err := input.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"ObservedQ":0`, `"ObservedV":null`, `"ScenarioAP":0`, `"Period":2`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("marshaled context missing %s: %s", want, data)
+		}
+	}
+
+	parsed, err := ParseContextInput(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Period != 2 {
+		t.Errorf("period = %d, want 2", parsed.Period)
+	}
+	if parsed.ObservedQ == nil || *parsed.ObservedQ != 0 {
+		t.Errorf("present zero ObservedQ lost: %v", parsed.ObservedQ)
+	}
+	if parsed.ObservedP == nil || *parsed.ObservedP != 20.5 {
+		t.Errorf("ObservedP = %v, want 20.5", parsed.ObservedP)
+	}
+	if parsed.ObservedV != nil || parsed.AggregateQ != nil {
+		t.Errorf("null fields should stay nil: %v %v", parsed.ObservedV, parsed.AggregateQ)
+	}
+
+	if _, err := ParseContextInput([]byte(`{"Unknown":1}`)); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
+
+func TestEncodeResultsStream(t *testing.T) {
+	var buf bytes.Buffer
+	inputs := samplePeriodInputs()
+	if err := EncodeResultsStream(&buf, NewFullCalcTemplate(), inputs, CalcOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("streamed output is not valid JSON: %v\n%s", err, buf.String())
+	}
+	if len(decoded) != len(inputs) {
+		t.Fatalf("decoded %d periods, want %d", len(decoded), len(inputs))
+	}
+	AssertResultClose(t, decoded[1], KeyTotalCost, 22.735, 1e-9)
+
+	buf.Reset()
+	if err := EncodeResultsStream(&buf, NewFullCalcTemplate(), nil, CalcOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "[]" {
+		t.Fatalf("empty batch encoded as %q", buf.String())
+	}
+}
+
+func TestRecordReplayRun(t *testing.T) {
+	input := samplePeriodInputs()[1]
+	input.AggregateV = nil
+	template := NewFullCalcTemplate()
+
+	var buf bytes.Buffer
+	if err := RecordRun(&buf, input, template); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed, nodes, hash, err := ReplayRun(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(replayed, input) {
+		t.Fatalf("replayed input = %+v, want %+v", replayed, input)
+	}
+	if hash != template.StructuralHash() {
+		t.Fatalf("hash = %s, want %s", hash, template.StructuralHash())
+	}
+
+	rebuilt, err := TemplateFor(nodes...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt.StructuralHash() != hash {
+		t.Fatal("rebuilt template differs from the recorded one")
+	}
+	want, err := input.Calc(template, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := replayed.Calc(rebuilt, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("replayed results = %v, want %v", got, want)
+	}
+}
+
+func TestMarshalResultsJSON(t *testing.T) {
+	noisy := 24.700000000000003
+	results := map[string]interface{}{
+		KeyTotalCost:       noisy,
+		KeyObservedMetrics: Result{Q: NewOptionalFloat(0.1 + 0.2), P: NewOptionalFloat(20.5)},
+		"label":            "ok",
+	}
+	if plain, _ := json.Marshal(results); !strings.Contains(string(plain), "24.700000000000003") {
+		t.Fatalf("expected encoding/json to keep float noise: %s", plain)
+	}
+
+	data, err := MarshalResultsJSON(results, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"label":"ok","observed_metrics":{"P":20.5,"Q":0.3,"V":null},"total_cost":24.7}`
+	if string(data) != want {
+		t.Fatalf("MarshalResultsJSON(-1) = %s, want %s", data, want)
+	}
+
+	computed, err := samplePeriodInputs()[1].Calc(NewFullCalcTemplate(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = MarshalResultsJSON(map[string]interface{}{KeyTotalCost: computed[KeyTotalCost], "precise": 123456789.12345678}, utils.PlacesExact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"precise":123456789.12345678,"total_cost":22.735}` {
+		t.Fatalf("MarshalResultsJSON(PlacesExact) = %s", data)
+	}
+
+	data, err = MarshalResultsJSON(map[string]interface{}{KeyTotalCost: noisy}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"total_cost":24.70}` {
+		t.Fatalf("MarshalResultsJSON(2) = %s", data)
+	}
+	var decoded map[string]float64
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded[KeyTotalCost] != 24.7 {
+		t.Fatalf("round trip = %v, %v", decoded, err)
+	}
+
+	if _, err := MarshalResultsJSON(map[string]interface{}{KeyTotalCost: math.NaN()}, -1); err == nil {
+		t.Fatal("expected error for NaN")
+	}
+}
@@ -0,0 +1,79 @@
+package dynamicformula
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/force-c/dynamic-formula/utils"
+)
+
+// numberLocale 是一种区域设置的千分位与小数点符号。
+type numberLocale struct {
+	group   string
+	decimal string
+}
+
+// numberLocales 是支持的区域设置，fr-FR 按 CLDR 使用窄不换行空格分组。
+var numberLocales = map[string]numberLocale{
+	"en-US": {group: ",", decimal: "."},
+	"de-DE": {group: ".", decimal: ","},
+	"fr-FR": {group: "\u202f", decimal: ","},
+}
+
+// DefaultLocale 是 Meta["locale"] 缺省时使用的区域设置。
+const DefaultLocale = "en-US"
+
+// FormatResultsLocalized 将结果中的 float64 数值按区域设置格式化，先十进制舍入到 places 位小数
+// （places 为负时使用最短的精确形式），非数值结果不出现在返回值中。未知区域设置返回错误。
+func FormatResultsLocalized(results map[string]interface{}, locale string, places int) (map[string]string, error) {
+	loc, ok := numberLocales[locale]
+	if !ok {
+		return nil, fmt.Errorf("unsupported locale %q", locale)
+	}
+	formatted := make(map[string]string, len(results))
+	for key, v := range results {
+		f, ok := v.(float64)
+		if !ok {
+			continue
+		}
+		formatted[key] = loc.format(utils.FormatDecimal(f, places))
+	}
+	return formatted, nil
+}
+
+// FormatResults 以 Meta["locale"]（缺省为 DefaultLocale）调用 FormatResultsLocalized。
+func (m ContextInput) FormatResults(results map[string]interface{}, places int) (map[string]string, error) {
+	locale, ok := m.Meta["locale"]
+	if !ok {
+		locale = DefaultLocale
+	}
+	return FormatResultsLocalized(results, locale, places)
+}
+
+// format 为 "-1234.5" 形式的十进制字符串加上千分位并替换小数点；NaN、Inf 原样返回。
+func (l numberLocale) format(s string) string {
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	integer, fraction, hasFraction := strings.Cut(s, ".")
+	for _, r := range integer {
+		if r < '0' || r > '9' {
+			return sign + s
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, r := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteString(l.group)
+		}
+		b.WriteRune(r)
+	}
+	if hasFraction {
+		b.WriteString(l.decimal)
+		b.WriteString(fraction)
+	}
+	return b.String()
+}
@@ -0,0 +1,45 @@
+package dynamicformula
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFormatResultsLocalized(t *testing.T) {
+	results := map[string]interface{}{
+		"amount":           1234.555,
+		"small":            -0.5,
+		"million":          1234567.0,
+		"nan":              math.NaN(),
+		KeyObservedMetrics: "{1, 2, 3}",
+	}
+	cases := map[string]map[string]string{
+		"en-US": {"amount": "1,234.56", "small": "-0.50", "million": "1,234,567.00", "nan": "NaN"},
+		"de-DE": {"amount": "1.234,56", "small": "-0,50", "million": "1.234.567,00", "nan": "NaN"},
+		"fr-FR": {"amount": "1\u202f234,56", "small": "-0,50", "million": "1\u202f234\u202f567,00", "nan": "NaN"},
+	}
+	for locale, want := range cases {
+		got, err := FormatResultsLocalized(results, locale, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("%s: got %v, want %v", locale, got, want)
+		}
+		for key, w := range want {
+			if got[key] != w {
+				t.Errorf("%s %s = %q, want %q", locale, key, got[key], w)
+			}
+		}
+	}
+
+	if _, err := FormatResultsLocalized(results, "xx-XX", 2); err == nil {
+		t.Fatal("expected error for unknown locale")
+	}
+
+	input := ContextInput{Meta: map[string]string{"locale": "de-DE"}}
+	got, err := input.FormatResults(map[string]interface{}{"amount": 1234.5}, -1)
+	if err != nil || got["amount"] != "1.234,5" {
+		t.Fatalf("FormatResults with Meta locale = %v, %v", got, err)
+	}
+}
@@ -0,0 +1,94 @@
+package dynamicformula
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// inputMemoization 是全局输入记忆化的配置与缓存。
+type inputMemoization struct {
+	cache *TTLCache
+	ttl   time.Duration
+}
+
+// inputMemoCapacity 是输入记忆化缓存的条目上限，超出时淘汰最久未访问的条目。
+const inputMemoCapacity = 4096
+
+// inputMemo 为 nil 时不做输入记忆化。
+var inputMemo atomic.Pointer[inputMemoization]
+
+// EnableInputMemoization 开启全局输入记忆化：输入节点的 Result 按节点注册标识与 ContextInput 的全部字段
+// 缓存 ttl 时长，跨 Calc 共享，适合执行查询的自定义适配器。重新注册或 SwapRegistries 替换的同名适配器
+// 不会命中旧结果。缓存最多保存 inputMemoCapacity 条。重复调用会以新的 ttl 重建空缓存。
+// 适配器必须只依赖 ContextInput 的内容，否则缓存结果可能过期。
+func EnableInputMemoization(ttl time.Duration) {
+	inputMemo.Store(&inputMemoization{cache: NewTTLCacheWithCapacity(inputMemoCapacity), ttl: ttl})
+}
+
+// DisableInputMemoization 关闭输入记忆化并丢弃已缓存的结果。
+func DisableInputMemoization() {
+	inputMemo.Store(nil)
+}
+
+// ClearInputMemoization 清空已缓存的输入结果，保持记忆化开启状态与 ttl 不变。
+func ClearInputMemoization() {
+	if memo := inputMemo.Load(); memo != nil {
+		inputMemo.CompareAndSwap(memo, &inputMemoization{cache: NewTTLCacheWithCapacity(inputMemoCapacity), ttl: memo.ttl})
+	}
+}
+
+// inputNodeIDs 为每次注册的输入节点分配递增标识。
+var inputNodeIDs atomic.Uint64
+
+// nextInputNodeID 返回新的输入节点标识，0 保留给未经注册直接构造的节点。
+func nextInputNodeID() uint64 {
+	return inputNodeIDs.Add(1)
+}
+
+// memoizedInput 在开启记忆化时先查缓存，未命中再调用 resolve 并缓存成功的结果。
+// 未经注册的节点（id 为 0）无法区分适配器，不做记忆化。
+func memoizedInput(name string, id uint64, m ContextInput, resolve func() (Result, error)) (Result, error) {
+	memo := inputMemo.Load()
+	if memo == nil || id == 0 {
+		return resolve()
+	}
+	key := inputMemoKey(name, id, m)
+	if cached, ok := memo.cache.Get(key); ok {
+		return cached.(Result), nil
+	}
+	r, err := resolve()
+	if err != nil {
+		return Result{}, err
+	}
+	memo.cache.Set(key, r, memo.ttl)
+	return r, nil
+}
+
+// inputMemoKey 由节点名与注册标识、期次、全部可选数值字段与按键排序的 Meta 拼出缓存键。
+func inputMemoKey(name string, id uint64, m ContextInput) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s#%d|Period=%d", name, id, m.Period)
+	for _, field := range optionalFloatFields {
+		value, _ := m.optionalField(field)
+		fmt.Fprintf(&b, "|%s=%s", field, formatOptional(value))
+	}
+	b.WriteString(formatMeta(m.Meta))
+	return b.String()
+}
+
+// formatMeta 把 Meta 按键排序格式化为缓存键片段，形如 |Meta."currency"="EUR"。
+func formatMeta(meta map[string]string) string {
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "|Meta.%q=%q", k, meta[k])
+	}
+	return b.String()
+}
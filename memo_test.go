@@ -0,0 +1,108 @@
+package dynamicformula
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInputMemoization(t *testing.T) {
+	preserveRegistries(t)
+	t.Cleanup(DisableInputMemoization)
+
+	calls := 0
+	RegisterInputNode("counted_input", func(m ContextInput) (q, p, v *OptionalFloat) {
+		calls++
+		return m.ObservedQ, nil, nil
+	})
+	template := NewCalcTemplate(FormulaNode{
+		name: "counted_double",
+		deps: []string{"counted_input"},
+		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
+			return float64(*prev["counted_input"].(Result).Q) * 2, nil
+		},
+	})
+	input := samplePeriodInputs()[0]
+
+	EnableInputMemoization(time.Minute)
+	for i := 0; i < 3; i++ {
+		data, err := input.Calc(template, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		AssertResultClose(t, data, "counted_double", 1.6, 1e-9)
+	}
+	if calls != 1 {
+		t.Fatalf("adapter invoked %d times for equal inputs, want 1", calls)
+	}
+
+	other := samplePeriodInputs()[1]
+	if _, err := other.Calc(template, false); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("different input must miss the cache, calls = %d", calls)
+	}
+
+	ClearInputMemoization()
+	if _, err := input.Calc(template, false); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Fatalf("cleared cache must be repopulated, calls = %d", calls)
+	}
+
+	DisableInputMemoization()
+	for i := 0; i < 2; i++ {
+		if _, err := input.Calc(template, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 5 {
+		t.Fatalf("disabled memoization must call the adapter every time, calls = %d", calls)
+	}
+}
+
+func TestInputMemoization_ReregisteredAdapter(t *testing.T) {
+	preserveRegistries(t)
+	t.Cleanup(DisableInputMemoization)
+	EnableInputMemoization(time.Minute)
+	if memo := inputMemo.Load(); memo.cache.maxEntries != inputMemoCapacity {
+		t.Fatalf("memo cache capacity = %d, want %d", memo.cache.maxEntries, inputMemoCapacity)
+	}
+
+	constant := func(v float64) InputAdapter {
+		return func(ContextInput) (q, p, v2 *OptionalFloat) { return NewOptionalFloat(v), nil, nil }
+	}
+	node := FormulaNode{
+		name: "memo_probe",
+		deps: []string{"memo_input"},
+		formula: func(_ ContextInput, prev map[string]interface{}) (float64, error) {
+			return float64(*prev["memo_input"].(Result).Q), nil
+		},
+	}
+	input := samplePeriodInputs()[0]
+	calc := func() float64 {
+		t.Helper()
+		data, err := input.Calc(NewCalcTemplate(node), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data["memo_probe"].(float64)
+	}
+
+	RegisterInputNode("memo_input", constant(1))
+	if got := calc(); got != 1 {
+		t.Fatalf("first adapter = %v, want 1", got)
+	}
+	RegisterInputNode("memo_input", constant(2))
+	if got := calc(); got != 2 {
+		t.Fatalf("re-registered adapter = %v, want 2", got)
+	}
+
+	SwapRegistries(map[string]FormulaNode{}, map[string]InputAdapter{
+		"memo_input": constant(3),
+	})
+	if got := calc(); got != 3 {
+		t.Fatalf("swapped adapter = %v, want 3", got)
+	}
+}
@@ -0,0 +1,58 @@
+package dynamicformula
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 内置公式可调参数名。
+const (
+	// ParamObservedAdjustment 是 scenario_margin 中 A 价低于 B 价时观测量的调整系数，默认 1.2。
+	ParamObservedAdjustment = "scenario_margin.observed_adjustment"
+	// ParamAggregateAdjustment 是 scenario_margin 中其余情形下汇总量的调整系数，默认 0.8。
+	ParamAggregateAdjustment = "scenario_margin.aggregate_adjustment"
+)
+
+// paramsKey 是模板参数在依赖结果中的保留键，节点名不应使用该键。
+const paramsKey = "$params"
+
+// WithParams 返回带常量参数的模板副本，公式通过 Param 读取；同名参数覆盖原模板中的值。
+func (t *CalcTemplate) WithParams(params map[string]float64) *CalcTemplate {
+	clone := t.clone()
+	clone.params = make(map[string]float64, len(t.params)+len(params))
+	for name, v := range t.params {
+		clone.params[name] = v
+	}
+	for name, v := range params {
+		clone.params[name] = v
+	}
+	return clone
+}
+
+// Param 从公式收到的依赖结果中读取模板参数，未设置时返回 def。
+func Param(prev map[string]interface{}, name string, def float64) float64 {
+	params, ok := prev[paramsKey].(map[string]float64)
+	if !ok {
+		return def
+	}
+	if v, ok := params[name]; ok {
+		return v
+	}
+	return def
+}
+
+// formatParams 按参数名排序格式化模板参数，供节点级缓存键使用。
+func formatParams(params map[string]float64) string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s=%s", name, strconv.FormatFloat(params[name], 'g', -1, 64))
+	}
+	return strings.Join(parts, ",")
+}
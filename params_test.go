@@ -0,0 +1,38 @@
+package dynamicformula
+
+import "testing"
+
+func TestCalcTemplate_WithParams(t *testing.T) {
+	template, err := TemplateFor(KeyScenarioMargin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := samplePeriodInputs()[0]
+
+	base, err := input.Calc(template, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A 价高于 B 价：(0.8×0.8 - 0.2 - 0.25) × (18.5 - 17.8)。
+	AssertResultClose(t, base, KeyScenarioMargin, 0.133, 1e-9)
+
+	tuned := template.WithParams(map[string]float64{ParamAggregateAdjustment: 0.5})
+	cache := NewTTLCache()
+	for _, tc := range []struct {
+		template *CalcTemplate
+		want     float64
+	}{
+		{tuned, -0.035},
+		{template, 0.133},
+	} {
+		data, err := input.CalcWithOptions(tc.template, CalcOptions{NodeCache: cache})
+		if err != nil {
+			t.Fatal(err)
+		}
+		AssertResultClose(t, data, KeyScenarioMargin, tc.want, 1e-9)
+	}
+
+	if got := Param(nil, ParamObservedAdjustment, 1.2); got != 1.2 {
+		t.Fatalf("Param default = %v, want 1.2", got)
+	}
+}
@@ -0,0 +1,94 @@
+package dynamicformula
+
+// WithPriority 返回带执行优先级的模板副本：同时就绪（依赖均已完成）的节点中，数值小的先执行，
+// 未指定的节点优先级为 0，同优先级保持默认顺序。优先级不会突破依赖约束。
+func (t *CalcTemplate) WithPriority(priorities map[string]int) *CalcTemplate {
+	clone := t.clone()
+	clone.priorities = make(map[string]int, len(priorities))
+	for name, p := range priorities {
+		clone.priorities[name] = p
+	}
+	return clone
+}
+
+// clone 复制模板的节点、配置与停用状态，供 With 系列方法在副本上修改。
+func (t *CalcTemplate) clone() *CalcTemplate {
+	clone := &CalcTemplate{
+		nodes:           t.nodes,
+		registry:        make(map[string]Node, len(t.registry)),
+		resolver:        t.resolver,
+		snapshot:        t.snapshot,
+		priorities:      t.priorities,
+		rounding:        t.rounding,
+		params:          t.params,
+		zeroDenominator: t.zeroDenominator,
+		disabled:        t.disabledSnapshot(),
+		validators:      t.inputValidators(),
+		invariants:      t.resultInvariants(),
+	}
+	for name, n := range t.registry {
+		clone.registry[name] = n
+	}
+	return clone
+}
+
+// prioritize 以 Kahn 算法重排已拓扑排序的节点，每步选出就绪节点中优先级最小、默认顺序最靠前的一个。
+func (t *CalcTemplate) prioritize(ordered []Node) []Node {
+	index := make(map[string]int, len(ordered))
+	for i, n := range ordered {
+		index[n.Name()] = i
+	}
+	pending := make([]int, len(ordered))
+	dependents := make([][]int, len(ordered))
+	for i, n := range ordered {
+		for _, dep := range t.depsOf(n) {
+			if j, ok := index[dep]; ok {
+				pending[i]++
+				dependents[j] = append(dependents[j], i)
+			}
+		}
+	}
+
+	var ready []int
+	for i := range ordered {
+		if pending[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	result := make([]Node, 0, len(ordered))
+	for len(ready) > 0 {
+		best := 0
+		for k := 1; k < len(ready); k++ {
+			if t.runsBefore(ordered, ready[k], ready[best]) {
+				best = k
+			}
+		}
+		i := ready[best]
+		ready = append(ready[:best], ready[best+1:]...)
+		result = append(result, ordered[i])
+		for _, d := range dependents[i] {
+			pending[d]--
+			if pending[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+	return result
+}
+
+func (t *CalcTemplate) runsBefore(ordered []Node, a, b int) bool {
+	pa, pb := t.priorities[ordered[a].Name()], t.priorities[ordered[b].Name()]
+	if pa != pb {
+		return pa < pb
+	}
+	return a < b
+}
+
+// CalcOrdered 计算模板并额外返回节点的实际执行顺序（不含被跳过的节点）。
+func (m ContextInput) CalcOrdered(t *CalcTemplate, opts CalcOptions) (map[string]interface{}, []string, error) {
+	run, err := m.evaluate(t, opts, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return run.results, run.order, nil
+}
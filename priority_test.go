@@ -0,0 +1,41 @@
+package dynamicformula
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCalcTemplate_WithPriority(t *testing.T) {
+	constant := func(name string, deps ...string) FormulaNode {
+		return FormulaNode{name: name, deps: deps, formula: func(ContextInput, map[string]interface{}) (float64, error) {
+			return 1, nil
+		}}
+	}
+	template := NewCalcTemplate(constant("prio_first"), constant("prio_second"), constant("prio_after_first", "prio_first"))
+
+	_, order, err := ContextInput{}.CalcOrdered(template, CalcOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"prio_first", "prio_second", "prio_after_first"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("default order = %v, want %v", order, want)
+	}
+
+	prioritized := template.WithPriority(map[string]int{"prio_second": -1, "prio_after_first": -2})
+	_, order, err = ContextInput{}.CalcOrdered(prioritized, CalcOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// prio_after_first 优先级最高，但必须等待其依赖 prio_first 完成。
+	if want := []string{"prio_second", "prio_first", "prio_after_first"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("prioritized order = %v, want %v", order, want)
+	}
+
+	_, order, err = ContextInput{}.CalcOrdered(template, CalcOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order[0] != "prio_first" {
+		t.Fatalf("WithPriority must not modify the original template, got %v", order)
+	}
+}
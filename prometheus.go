@@ -0,0 +1,57 @@
+package dynamicformula
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WriteResultsPrometheus 以 Prometheus/OpenMetrics 文本格式输出结果：每个 float64 结果写为名为
+// namespace_<node> 的 gauge，并附 HELP/TYPE 行。名称中的非法字符替换为下划线，非数值结果跳过。
+func WriteResultsPrometheus(w io.Writer, namespace string, results map[string]interface{}) error {
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, ok := results[name].(float64)
+		if !ok {
+			continue
+		}
+		metric := sanitizeMetricName(name)
+		if namespace != "" {
+			metric = sanitizeMetricName(namespace) + "_" + metric
+		}
+		if _, err := fmt.Fprintf(w, "# HELP %s Result of formula node %s.\n# TYPE %s gauge\n%s %s\n",
+			metric, name, metric, metric, strconv.FormatFloat(value, 'g', -1, 64)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sanitizeMetricName 将名称转换为合法的指标名：[a-zA-Z_:][a-zA-Z0-9_:]*。
+func sanitizeMetricName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r == '_' || r == ':' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
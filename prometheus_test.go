@@ -0,0 +1,42 @@
+package dynamicformula
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestWriteResultsPrometheus(t *testing.T) {
+	results, err := samplePeriodInputs()[0].Calc(NewFullCalcTemplate(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results["9 odd-name"] = 1.5
+
+	var buf bytes.Buffer
+	if err := WriteResultsPrometheus(&buf, "dynamic_formula", results); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"# TYPE dynamic_formula_unit_yield gauge\n",
+		"\ndynamic_formula_unit_yield 0.14\n",
+		"\ndynamic_formula__9_odd_name 1.5\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, KeyAggregateMetrics) {
+		t.Errorf("non-numeric input results must be skipped:\n%s", out)
+	}
+
+	sample := regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]* \S+$`)
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if !strings.HasPrefix(line, "# ") && !sample.MatchString(line) {
+			t.Errorf("invalid sample line %q", line)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package dynamicformula
+
+import "math"
+
+// provenancePeriodProbe 是探测输入适配器是否读取 Period 时使用的哨兵期次。
+const provenancePeriodProbe = math.MinInt32
+
+// CalcWithProvenance 计算模板并返回每个公式节点的输入溯源：节点名到参与计算的 ContextInput 字段名列表。
+// 字段来自节点自身及传递依赖声明的 InputFields，以及传递依赖的输入节点所暴露的字段，按结构体声明顺序排列。
+func (m ContextInput) CalcWithProvenance(t *CalcTemplate) (map[string]interface{}, map[string][]string, error) {
+	results, err := m.Calc(t, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	ordered, err := t.GetOrderedNodes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fieldSets := make(map[string]map[string]bool, len(ordered))
+	provenance := make(map[string][]string)
+	for _, n := range ordered {
+		set := make(map[string]bool)
+		if isInputNode(n) {
+			for _, field := range inputNodeFields(n) {
+				set[field] = true
+			}
+			fieldSets[n.Name()] = set
+			continue
+		}
+		if formula, ok := unwrapFormula(n); ok {
+			for _, field := range formula.InputFields {
+				set[field] = true
+			}
+		}
+		for _, dep := range n.Requires() {
+			for field := range fieldSets[dep] {
+				set[field] = true
+			}
+		}
+		fieldSets[n.Name()] = set
+		provenance[n.Name()] = orderedContextFields(set)
+	}
+	return results, provenance, nil
+}
+
+// unwrapFormula 取出节点（含装饰器包装）中的 FormulaNode。
+func unwrapFormula(n Node) (FormulaNode, bool) {
+	switch node := n.(type) {
+	case FormulaNode:
+		return node, true
+	case historyNode:
+		return unwrapFormula(node.Node)
+	default:
+		return FormulaNode{}, false
+	}
+}
+
+// inputNodeFields 用探针上下文调用输入适配器，识别其直接暴露的 ContextInput 字段。
+// 按需获取的输入节点不做探测，以免触发外部调用。
+func inputNodeFields(n Node) []string {
+	switch node := n.(type) {
+	case historyNode:
+		return inputNodeFields(node.Node)
+	case inputNode:
+		probe := ContextInput{Period: provenancePeriodProbe}
+		pointers := make(map[*OptionalFloat]string, len(optionalFloatFields))
+		for _, name := range optionalFloatFields {
+			_ = probe.setOptionalField(name, 0)
+			value, _ := probe.optionalField(name)
+			pointers[value] = name
+		}
+
+		var fields []string
+		q, p, v := node.resolve(probe)
+		for _, component := range []*OptionalFloat{q, p, v} {
+			if component == nil {
+				continue
+			}
+			if name, ok := pointers[component]; ok {
+				fields = append(fields, name)
+			} else if float64(*component) == provenancePeriodProbe {
+				fields = append(fields, "Period")
+			}
+		}
+		return fields
+	default:
+		return nil
+	}
+}
+
+// orderedContextFields 将字段集合按 ContextInput 的声明顺序输出。
+func orderedContextFields(set map[string]bool) []string {
+	fields := make([]string, 0, len(set))
+	if set["Period"] {
+		fields = append(fields, "Period")
+	}
+	for _, name := range optionalFloatFields {
+		if set[name] {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,43 @@
+package dynamicformula
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCalcWithProvenance(t *testing.T) {
+	input := samplePeriodInputs()[0]
+	results, provenance, err := input.CalcWithProvenance(NewFullCalcTemplate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertResultClose(t, results, KeyTotalCost, 15.4, 1e-9)
+
+	fields := make(map[string]bool)
+	for _, field := range provenance[KeyTotalCost] {
+		fields[field] = true
+	}
+	for _, want := range []string{"BaselineQ", "BaselineP", "BaselineV", "ScenarioAV", "ScenarioBV", "ScenarioAP", "ObservedQ"} {
+		if !fields[want] {
+			t.Errorf("total_cost provenance %v missing %s", provenance[KeyTotalCost], want)
+		}
+	}
+	if fields["OverheadV"] || fields["Period"] {
+		t.Errorf("total_cost provenance %v contains unrelated fields", provenance[KeyTotalCost])
+	}
+	if _, ok := provenance[KeyBaselineMetrics]; ok {
+		t.Error("input nodes should not have provenance entries")
+	}
+
+	want := []string{"BaselineQ", "BaselineP", "BaselineV", "ScenarioAQ", "ScenarioAP", "ScenarioAV", "ScenarioBQ", "ScenarioBP", "ScenarioBV"}
+	if got := provenance[KeyBaseCost]; !reflect.DeepEqual(got, want) {
+		t.Errorf("base_cost provenance = %v, want %v", got, want)
+	}
+}
+
+func TestInputNodeFields_Period(t *testing.T) {
+	node, _ := lookupRegistered(KeyPeriod)
+	if got := inputNodeFields(node); !reflect.DeepEqual(got, []string{"Period"}) {
+		t.Fatalf("period input fields = %v", got)
+	}
+}
@@ -0,0 +1,157 @@
+package dynamicformula
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// defaultQuantileCompression 是 QuantileEstimator 零值使用的压缩参数。
+const defaultQuantileCompression = 100
+
+// centroid 是 t-digest 中一组相邻样本的均值与权重。
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+// QuantileEstimator 是 t-digest 风格的近似分位数累加器：样本被合并为不超过 Compression 个质心，
+// 两端质心更小，因此尾部分位数更精确。内存占用与样本数无关。零值可直接使用，非并发安全。
+type QuantileEstimator struct {
+	// Compression 控制精度与内存的权衡，零值时为 100。质心数不超过该值。
+	Compression float64
+
+	centroids []centroid
+	buffer    []float64
+	count     float64
+	min, max  float64
+}
+
+func (e *QuantileEstimator) compression() float64 {
+	if e.Compression > 0 {
+		return e.Compression
+	}
+	return defaultQuantileCompression
+}
+
+// Add 加入一个样本，NaN 被忽略。
+func (e *QuantileEstimator) Add(x float64) {
+	if math.IsNaN(x) {
+		return
+	}
+	if e.count == 0 || x < e.min {
+		e.min = x
+	}
+	if e.count == 0 || x > e.max {
+		e.max = x
+	}
+	e.count++
+	e.buffer = append(e.buffer, x)
+	if len(e.buffer) >= int(5*e.compression()) {
+		e.flush()
+	}
+}
+
+// Count 返回已加入的样本数。
+func (e *QuantileEstimator) Count() int {
+	return int(e.count)
+}
+
+// flush 把缓冲区样本与已有质心按均值排序后重新合并。合并使用 k1 尺度函数 k(q) = δ/(2π)·asin(2q-1)：
+// 单个质心覆盖的分位区间在 k 上的跨度不超过 1，因此质心数不超过 δ，且越靠近两端质心越小。
+func (e *QuantileEstimator) flush() {
+	if len(e.buffer) == 0 {
+		return
+	}
+	all := make([]centroid, 0, len(e.centroids)+len(e.buffer))
+	all = append(all, e.centroids...)
+	for _, x := range e.buffer {
+		all = append(all, centroid{mean: x, weight: 1})
+	}
+	e.buffer = e.buffer[:0]
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+
+	scale := e.compression() / (2 * math.Pi)
+	k := func(q float64) float64 { return scale * math.Asin(2*math.Min(q, 1)-1) }
+
+	merged := all[:1]
+	cumulative := 0.0
+	kLeft := k(0)
+	for _, c := range all[1:] {
+		last := &merged[len(merged)-1]
+		if k((cumulative+last.weight+c.weight)/e.count)-kLeft <= 1 {
+			last.mean += (c.mean - last.mean) * c.weight / (last.weight + c.weight)
+			last.weight += c.weight
+			continue
+		}
+		cumulative += last.weight
+		kLeft = k(cumulative / e.count)
+		merged = append(merged, c)
+	}
+	e.centroids = append(e.centroids[:0], merged...)
+}
+
+// Quantile 返回 q 分位数（0 <= q <= 1）的估计值，相邻质心之间按累计权重线性插值；没有样本时返回 NaN。
+func (e *QuantileEstimator) Quantile(q float64) float64 {
+	e.flush()
+	if e.count == 0 || q < 0 || q > 1 {
+		return math.NaN()
+	}
+	switch {
+	case q == 0:
+		return e.min
+	case q == 1:
+		return e.max
+	case len(e.centroids) == 1:
+		return e.centroids[0].mean
+	}
+
+	target := q * e.count
+	// 每个质心的权重视为以其均值为中心分布，左端点为 min、右端点为 max。
+	prevMean, prevPos := e.min, 0.0
+	cumulative := 0.0
+	for _, c := range e.centroids {
+		pos := cumulative + c.weight/2
+		if target < pos {
+			if pos == prevPos {
+				return c.mean
+			}
+			return prevMean + (c.mean-prevMean)*(target-prevPos)/(pos-prevPos)
+		}
+		prevMean, prevPos = c.mean, pos
+		cumulative += c.weight
+	}
+	if e.count == prevPos {
+		return e.max
+	}
+	return prevMean + (e.max-prevMean)*(target-prevPos)/(e.count-prevPos)
+}
+
+// EstimateResultQuantile 从通道中逐个读取结果，以 QuantileEstimator 估计 key 的 q 分位数，内存占用与批量大小无关。
+// key 的写法同 ResultValue。遇到无法读取的结果时仍会读完通道以免阻塞生产者，然后返回首个错误。
+func EstimateResultQuantile(results <-chan map[string]interface{}, key string, q float64) (float64, error) {
+	if q < 0 || q > 1 {
+		return 0, fmt.Errorf("quantile %v is outside [0, 1]", q)
+	}
+	var estimator QuantileEstimator
+	var firstErr error
+	i := 0
+	for r := range results {
+		if firstErr == nil {
+			value, err := ResultValue(r, key)
+			if err != nil {
+				firstErr = fmt.Errorf("result set %d: %w", i, err)
+			} else {
+				estimator.Add(value)
+			}
+		}
+		i++
+	}
+	if firstErr != nil {
+		return 0, firstErr
+	}
+	if estimator.Count() == 0 {
+		return 0, fmt.Errorf("no results to compute quantile of %s", key)
+	}
+	return estimator.Quantile(q), nil
+}
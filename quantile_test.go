@@ -0,0 +1,71 @@
+package dynamicformula
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestQuantileEstimator(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	const n = 20000
+	var estimator QuantileEstimator
+	batch := make([]map[string]interface{}, 0, n)
+	for _, i := range rng.Perm(n) {
+		x := float64(i)
+		estimator.Add(x)
+		batch = append(batch, map[string]interface{}{KeyTotalCost: x})
+	}
+	if got := estimator.Count(); got != n {
+		t.Fatalf("Count() = %d, want %d", got, n)
+	}
+	if len(estimator.centroids) > defaultQuantileCompression {
+		t.Fatalf("estimator kept %d centroids", len(estimator.centroids))
+	}
+
+	for _, q := range []float64{0.01, 0.1, 0.5, 0.9, 0.99} {
+		exact, err := ResultQuantile(batch, KeyTotalCost, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 允许误差为取值范围的 0.5%。
+		if got := estimator.Quantile(q); math.Abs(got-exact) > 0.005*n {
+			t.Errorf("Quantile(%v) = %v, exact %v", q, got, exact)
+		}
+	}
+	if estimator.Quantile(0) != 0 || estimator.Quantile(1) != n-1 {
+		t.Fatalf("extremes = %v, %v", estimator.Quantile(0), estimator.Quantile(1))
+	}
+	if !math.IsNaN(new(QuantileEstimator).Quantile(0.5)) {
+		t.Fatal("empty estimator must return NaN")
+	}
+}
+
+func TestEstimateResultQuantile(t *testing.T) {
+	results := make(chan map[string]interface{})
+	go func() {
+		defer close(results)
+		for i := 1; i <= 1000; i++ {
+			results <- map[string]interface{}{KeyTotalCost: float64(i)}
+		}
+	}()
+	got, err := EstimateResultQuantile(results, KeyTotalCost, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(got-500.5) > 5 {
+		t.Fatalf("median estimate = %v, want about 500.5", got)
+	}
+
+	bad := make(chan map[string]interface{}, 3)
+	bad <- map[string]interface{}{KeyTotalCost: 1.0}
+	bad <- map[string]interface{}{}
+	bad <- map[string]interface{}{KeyTotalCost: 2.0}
+	close(bad)
+	if _, err := EstimateResultQuantile(bad, KeyTotalCost, 0.5); err == nil {
+		t.Fatal("expected error for missing key")
+	}
+	if len(bad) != 0 {
+		t.Fatal("channel must be drained")
+	}
+}
@@ -0,0 +1,202 @@
+package dynamicformula
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// preserveRegistries 在测试结束时恢复当前的全局注册表，并返回该快照。
+func preserveRegistries(t testing.TB) *registrySnapshot {
+	saved := currentRegistries()
+	t.Cleanup(func() {
+		registryMutex.Lock()
+		defer registryMutex.Unlock()
+		registries.Store(&registrySnapshot{
+			generation: currentRegistries().generation + 1,
+			formulas:   saved.formulas,
+			inputs:     saved.inputs,
+		})
+	})
+	return saved
+}
+
+func TestSwapRegistries_Concurrent(t *testing.T) {
+	saved := preserveRegistries(t)
+
+	original := make(map[string]FormulaNode)
+	for name, n := range saved.formulas {
+		original[name] = n.(FormulaNode)
+	}
+	inputs := make(map[string]InputAdapter)
+	for name, n := range saved.inputs {
+		if node, ok := n.(inputNode); ok {
+			inputs[name] = node.resolve
+		}
+	}
+	marker := func(name string, deps ...string) FormulaNode {
+		return FormulaNode{
+			name: name,
+			deps: deps,
+			formula: func(ContextInput, map[string]interface{}) (float64, error) {
+				return -1, nil
+			},
+		}
+	}
+	replaced := make(map[string]FormulaNode, len(original))
+	for name, n := range original {
+		replaced[name] = n
+	}
+	replaced[KeyTotalCost] = marker(KeyTotalCost, KeyBaseCost)
+	replaced[KeyNetMargin] = marker(KeyNetMargin, KeyScenarioMargin)
+
+	input := samplePeriodInputs()[0]
+	var wg sync.WaitGroup
+	errs := make(chan string, 64)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				data, err := input.Calc(NewFullCalcTemplate(), false)
+				if err != nil {
+					errs <- err.Error()
+					return
+				}
+				total, net := data[KeyTotalCost].(float64), data[KeyNetMargin].(float64)
+				oldSet := total == 15.4 && net > 0.1119 && net < 0.1121
+				newSet := total == -1 && net == -1
+				if !oldSet && !newSet {
+					errs <- "mixed registry view"
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		if i%2 == 0 {
+			SwapRegistries(replaced, inputs)
+		} else {
+			SwapRegistries(original, inputs)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for msg := range errs {
+		t.Fatal(msg)
+	}
+}
+
+func TestSwapRegistries_InvalidatesSortCache(t *testing.T) {
+	preserveRegistries(t)
+
+	probe := RatioNode("swap_probe", "swap_dep", KeyAggregateMetrics, 4)
+	inputs := map[string]InputAdapter{
+		KeyAggregateMetrics: func(m ContextInput) (q, p, v *OptionalFloat) { return m.AggregateQ, nil, nil },
+	}
+	constant := func(value float64, deps ...string) FormulaNode {
+		return FormulaNode{deps: deps, formula: func(ContextInput, map[string]interface{}) (float64, error) {
+			return value, nil
+		}}
+	}
+	SwapRegistries(map[string]FormulaNode{"swap_dep": constant(1)}, inputs)
+	if _, err := NewCalcTemplate(probe).GetOrderedNodes(); err != nil {
+		t.Fatal(err)
+	}
+
+	SwapRegistries(map[string]FormulaNode{
+		"swap_dep":   constant(1, "swap_inner"),
+		"swap_inner": constant(2),
+	}, inputs)
+	ordered, err := NewCalcTemplate(probe).GetOrderedNodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ordered) != 4 || ordered[0].Name() != "swap_inner" {
+		names := make([]string, len(ordered))
+		for i, n := range ordered {
+			names[i] = n.Name()
+		}
+		t.Fatalf("stale ordering after swap: %v", names)
+	}
+}
+
+func TestGetOrderedNodes_StaleCacheDetectsCycle(t *testing.T) {
+	constant := func(name string, deps ...string) FormulaNode {
+		return FormulaNode{name: name, deps: deps, formula: func(ContextInput, map[string]interface{}) (float64, error) {
+			return 1, nil
+		}}
+	}
+	preserveRegistries(t)
+
+	RegisterFormula(constant("cycle_inner"))
+	if _, err := NewCalcTemplate(constant("cycle_outer", "cycle_inner")).GetOrderedNodes(); err != nil {
+		t.Fatal(err)
+	}
+	RegisterFormula(constant("cycle_inner", "cycle_outer"))
+	RegisterFormula(constant("cycle_outer", "cycle_inner"))
+	if _, err := NewCalcTemplate(constant("cycle_outer", "cycle_inner")).GetOrderedNodes(); err == nil {
+		t.Fatal("expected the newly introduced cycle to be detected")
+	}
+
+	// 同名但依赖方向相反的模板节点不会改变注册表版本，需靠依赖校验识破缓存。
+	first := NewCalcTemplate(constant("local_a", "local_b"), constant("local_b"))
+	if _, err := first.GetOrderedNodes(); err != nil {
+		t.Fatal(err)
+	}
+	second := NewCalcTemplate(constant("local_a"), constant("local_b", "local_a"))
+	ordered, err := second.GetOrderedNodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ordered[0].Name() != "local_a" {
+		t.Fatalf("stale cached order reused: %s first", ordered[0].Name())
+	}
+}
+
+func TestNewFullCalcTemplateChecked_MissingBuiltin(t *testing.T) {
+	preserveRegistries(t)
+
+	if _, err := NewFullCalcTemplateChecked(); err != nil {
+		t.Fatalf("unexpected error with all built-ins registered: %v", err)
+	}
+
+	updateRegistries(func(formulas, _ map[string]Node) {
+		delete(formulas, KeyNetMargin)
+	})
+	_, err := NewFullCalcTemplateChecked()
+	if err == nil || !strings.Contains(err.Error(), KeyNetMargin) {
+		t.Fatalf("expected error naming %s, got %v", KeyNetMargin, err)
+	}
+
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), KeyNetMargin) {
+			t.Fatalf("expected panic naming %s, got %v", KeyNetMargin, r)
+		}
+	}()
+	NewFullCalcTemplate()
+}
+
+func TestNewPricingTemplateChecked_MissingBuiltin(t *testing.T) {
+	preserveRegistries(t)
+
+	if _, err := NewPricingTemplateChecked(); err != nil {
+		t.Fatalf("unexpected error with all built-ins registered: %v", err)
+	}
+
+	updateRegistries(func(formulas, _ map[string]Node) {
+		delete(formulas, KeyBlendedPrice)
+	})
+	_, err := NewPricingTemplateChecked()
+	if err == nil || !strings.Contains(err.Error(), KeyBlendedPrice) {
+		t.Fatalf("expected error naming %s, got %v", KeyBlendedPrice, err)
+	}
+
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), KeyBlendedPrice) {
+			t.Fatalf("expected panic naming %s, got %v", KeyBlendedPrice, r)
+		}
+	}()
+	NewPricingTemplate()
+}
@@ -0,0 +1,65 @@
+package dynamicformula
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// EvaluationReport 汇总单次计算的结果、节点耗时、分支走向、跳过节点与输入快照。
+type EvaluationReport struct {
+	Results  map[string]interface{}   `json:"results"`
+	Timings  map[string]time.Duration `json:"timings"`
+	Branches map[string]string        `json:"branches,omitempty"`
+	Skipped  []string                 `json:"skipped,omitempty"`
+	Input    ContextInput             `json:"input"`
+}
+
+// CalcReport 执行模板并返回完整的计算报告。
+func (m ContextInput) CalcReport(t *CalcTemplate, opts CalcOptions) (*EvaluationReport, error) {
+	run, err := m.evaluate(t, opts, true)
+	if err != nil {
+		return nil, err
+	}
+	return &EvaluationReport{
+		Results:  run.results,
+		Timings:  run.timings,
+		Branches: run.branches,
+		Skipped:  run.skipped,
+		Input:    m,
+	}, nil
+}
+
+// JSON 将报告序列化为 JSON，耗时以纳秒表示。
+func (r *EvaluationReport) JSON() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// String 以按节点名排序的多行文本输出报告。
+func (r *EvaluationReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "period %d\n", r.Input.Period)
+
+	names := make([]string, 0, len(r.Timings))
+	for name := range r.Timings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "  %s", name)
+		if v, ok := r.Results[name]; ok {
+			fmt.Fprintf(&b, " = %v", v)
+		}
+		fmt.Fprintf(&b, " (%s)", r.Timings[name])
+		if branch, ok := r.Branches[name]; ok {
+			fmt.Fprintf(&b, " [%s]", branch)
+		}
+		b.WriteString("\n")
+	}
+	if len(r.Skipped) > 0 {
+		fmt.Fprintf(&b, "  skipped: %s\n", strings.Join(r.Skipped, ", "))
+	}
+	return b.String()
+}
@@ -0,0 +1,65 @@
+package dynamicformula
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCalcReport_FullTemplate(t *testing.T) {
+	input := ContextInput{
+		Period:     1,
+		ObservedQ:  NewOptionalFloat(0.8),
+		AggregateQ: NewOptionalFloat(0.8),
+		BaselineQ:  NewOptionalFloat(0.2),
+		BaselineV:  NewOptionalFloat(4.3),
+		ScenarioAQ: NewOptionalFloat(0.25),
+		ScenarioAP: NewOptionalFloat(18.5),
+		ScenarioAV: NewOptionalFloat(4.625),
+		ScenarioBQ: NewOptionalFloat(0.35),
+		ScenarioBP: NewOptionalFloat(17.8),
+		ScenarioBV: NewOptionalFloat(6.23),
+	}
+
+	report, err := input.CalcReport(NewFullCalcTemplate(), CalcOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{
+		KeyBaseCost,
+		KeySettlementImpact,
+		KeyScenarioMargin,
+		KeyTotalCost,
+		KeyNetMargin,
+		KeyUnitYield,
+	} {
+		if _, ok := report.Timings[key]; !ok {
+			t.Errorf("missing timing for %s", key)
+		}
+		if _, ok := report.Results[key]; !ok {
+			t.Errorf("missing result for %s", key)
+		}
+	}
+	if got := report.Branches[KeySettlementImpact]; got != BranchScenarioBCheaperOrEqual {
+		t.Errorf("settlement branch = %q", got)
+	}
+	if report.Input.Period != 1 {
+		t.Errorf("input snapshot period = %d", report.Input.Period)
+	}
+
+	data, err := report.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := decoded["timings"]; !ok {
+		t.Errorf("json report missing timings: %s", data)
+	}
+	if !strings.Contains(report.String(), KeyUnitYield) {
+		t.Errorf("string report missing %s:\n%s", KeyUnitYield, report.String())
+	}
+}
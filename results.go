@@ -0,0 +1,330 @@
+package dynamicformula
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/force-c/dynamic-formula/utils"
+	"github.com/shopspring/decimal"
+)
+
+// marginalCostPlaces 是边际成本的保留小数位，与单位收益一致。
+const marginalCostPlaces = 4
+
+// ResultValue 从 Calc 结果中读取数值。key 可以是节点名，也可以是 "节点名.Q/P/V" 以读取输入节点分量；
+// 兼容 float64、数值字符串、Result 与 Calc 输出的 "{q, p, v}" 字符串几种形式。
+func ResultValue(results map[string]interface{}, key string) (float64, error) {
+	name, component := key, ""
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		name, component = key[:i], key[i+1:]
+	}
+
+	raw, ok := results[name]
+	if !ok {
+		return 0, fmt.Errorf("result %s not found", name)
+	}
+
+	switch value := raw.(type) {
+	case float64:
+		if component != "" {
+			return 0, fmt.Errorf("result %s is a scalar and has no component %s", name, component)
+		}
+		return value, nil
+	case Result:
+		return resultComponentValue(value, name, component)
+	case string:
+		if !strings.HasPrefix(strings.TrimSpace(value), "{") {
+			f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				return 0, fmt.Errorf("result %s: malformed numeric string %q", name, value)
+			}
+			if component != "" {
+				return 0, fmt.Errorf("result %s is a scalar and has no component %s", name, component)
+			}
+			return f, nil
+		}
+		parsed, err := parseResultString(value)
+		if err != nil {
+			return 0, fmt.Errorf("result %s: %w", name, err)
+		}
+		return resultComponentValue(parsed, name, component)
+	default:
+		return 0, fmt.Errorf("result %s has non-numeric type %T", name, raw)
+	}
+}
+
+func resultComponentValue(r Result, name, component string) (float64, error) {
+	if component == "" {
+		return 0, fmt.Errorf("result %s is a Q/P/V triple, specify a component", name)
+	}
+	value, err := r.Component(component)
+	if err != nil {
+		return 0, err
+	}
+	if value == nil {
+		return 0, fmt.Errorf("result %s.%s is nil", name, component)
+	}
+	return float64(*value), nil
+}
+
+// parseResultString 解析 Calc 对 Result 的字符串化形式 "{q, p, v}"。
+func parseResultString(s string) (Result, error) {
+	trimmed := strings.TrimSpace(s)
+	if !strings.HasPrefix(trimmed, "{") || !strings.HasSuffix(trimmed, "}") {
+		return Result{}, fmt.Errorf("malformed result string %q", s)
+	}
+	parts := strings.Split(trimmed[1:len(trimmed)-1], ",")
+	if len(parts) != 3 {
+		return Result{}, fmt.Errorf("malformed result string %q", s)
+	}
+	components := make([]*OptionalFloat, 3)
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "<nil>" {
+			continue
+		}
+		f, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return Result{}, fmt.Errorf("malformed result string %q: %w", s, err)
+		}
+		components[i] = NewOptionalFloat(f)
+	}
+	return Result{Q: components[0], P: components[1], V: components[2]}, nil
+}
+
+// SumResults 对 keys 指定的结果做十进制求和，key 的写法同 ResultValue；任一结果缺失或非数值时返回错误。
+func SumResults(results map[string]interface{}, keys []string) (float64, error) {
+	values := make([]float64, 0, len(keys))
+	for _, key := range keys {
+		v, err := ResultValue(results, key)
+		if err != nil {
+			return 0, err
+		}
+		values = append(values, v)
+	}
+	return utils.DecimalAdd(values...), nil
+}
+
+// MarginalCost 计算相邻两期的边际成本：总成本变化量 / qKey 对应数量的变化量。
+// qKey 的写法同 ResultValue，例如 "aggregate_metrics.Q"；数量没有变化时返回错误。
+func MarginalCost(prev, curr map[string]interface{}, qKey string) (float64, error) {
+	prevCost, err := ResultValue(prev, KeyTotalCost)
+	if err != nil {
+		return 0, fmt.Errorf("previous period: %w", err)
+	}
+	currCost, err := ResultValue(curr, KeyTotalCost)
+	if err != nil {
+		return 0, fmt.Errorf("current period: %w", err)
+	}
+	prevQ, err := ResultValue(prev, qKey)
+	if err != nil {
+		return 0, fmt.Errorf("previous period: %w", err)
+	}
+	currQ, err := ResultValue(curr, qKey)
+	if err != nil {
+		return 0, fmt.Errorf("current period: %w", err)
+	}
+
+	deltaQ := utils.DecimalSubtract(currQ, prevQ)
+	if deltaQ == 0 {
+		return 0, fmt.Errorf("quantity %s did not change between periods", qKey)
+	}
+	deltaCost := utils.DecimalSubtract(currCost, prevCost)
+	return utils.DecimalDivide(deltaCost, deltaQ, marginalCostPlaces), nil
+}
+
+// ResultMedian 返回多期结果中 key 的中位数，key 的写法同 ResultValue。
+func ResultMedian(results []map[string]interface{}, key string) (float64, error) {
+	return ResultQuantile(results, key, 0.5)
+}
+
+// ResultQuantile 返回多期结果中 key 的 q 分位数（0 <= q <= 1），相邻样本之间按十进制线性插值。
+func ResultQuantile(results []map[string]interface{}, key string, q float64) (float64, error) {
+	if len(results) == 0 {
+		return 0, fmt.Errorf("no results to compute quantile of %s", key)
+	}
+	if q < 0 || q > 1 {
+		return 0, fmt.Errorf("quantile %v is outside [0, 1]", q)
+	}
+	values := make([]float64, len(results))
+	for i, r := range results {
+		value, err := ResultValue(r, key)
+		if err != nil {
+			return 0, fmt.Errorf("result set %d: %w", i, err)
+		}
+		values[i] = value
+	}
+	sort.Float64s(values)
+
+	pos := utils.DecimalMul(q, float64(len(values)-1))
+	lower := int(pos)
+	if lower == len(values)-1 {
+		return values[lower], nil
+	}
+	frac := utils.DecimalSubtract(pos, float64(lower))
+	return utils.DecimalLerpUnclamped(values[lower], values[lower+1], frac), nil
+}
+
+// CumulativeResults 返回按期次顺序排列的多期结果中 key 的累计值（年初至今），第 i 项为前 i+1 期的十进制和。
+// key 的写法同 ResultValue，任一期缺失或非数值时返回错误。
+func CumulativeResults(results []map[string]interface{}, key string) ([]float64, error) {
+	cumulative := make([]float64, len(results))
+	running := 0.0
+	for i, r := range results {
+		value, err := ResultValue(r, key)
+		if err != nil {
+			return nil, fmt.Errorf("result set %d: %w", i, err)
+		}
+		running = utils.DecimalAdd(running, value)
+		cumulative[i] = running
+	}
+	return cumulative, nil
+}
+
+// AggregateFunc 把一期的取值折叠进累计值，供 CalcBatchReduce 使用。
+type AggregateFunc func(acc, value float64) float64
+
+// SumAgg 以十进制加法累加，初始值通常为 0。
+func SumAgg(acc, value float64) float64 { return utils.DecimalAdd(acc, value) }
+
+// MaxAgg 取较大值，初始值通常为 math.Inf(-1)。
+func MaxAgg(acc, value float64) float64 { return math.Max(acc, value) }
+
+// MinAgg 取较小值，初始值通常为 math.Inf(1)。
+func MinAgg(acc, value float64) float64 { return math.Min(acc, value) }
+
+// CalcBatchReduce 按输入顺序逐期计算模板，并以 fn 从 initial 开始折叠各期 key 的取值；没有输入时返回 initial。
+// key 的写法同 ResultValue，输入节点分量（如 "aggregate_metrics.Q"）同样可用。任一期计算失败或缺少 key 时返回错误。
+func CalcBatchReduce(t *CalcTemplate, inputs []ContextInput, key string, initial float64, fn AggregateFunc) (float64, error) {
+	if fn == nil {
+		return 0, fmt.Errorf("nil aggregate function")
+	}
+	acc := initial
+	for i, input := range inputs {
+		results, err := input.CalcWithOptions(t, CalcOptions{IncludeInputNodes: true})
+		if err != nil {
+			return 0, fmt.Errorf("period %d (index %d): %w", input.Period, i, err)
+		}
+		value, err := ResultValue(results, key)
+		if err != nil {
+			return 0, fmt.Errorf("period %d (index %d): %w", input.Period, i, err)
+		}
+		acc = fn(acc, value)
+	}
+	return acc, nil
+}
+
+// WithBaselineFromResults 以上一期结果中的汇总指标（aggregate_metrics，需以 includeInputNodes 计算）
+// 作为本期基线，返回新的上下文。上一期缺失的分量在新上下文中记为 nil。
+func (m ContextInput) WithBaselineFromResults(prev map[string]interface{}) ContextInput {
+	component := func(c string) *OptionalFloat {
+		value, err := ResultValue(prev, KeyAggregateMetrics+"."+c)
+		if err != nil {
+			return nil
+		}
+		return NewOptionalFloat(value)
+	}
+	m.BaselineQ = component("Q")
+	m.BaselineP = component("P")
+	m.BaselineV = component("V")
+	return m
+}
+
+// MovingBaseline 以 history 末尾 window 期观测指标（Observed Q/P/V）的逐分量十进制平均值作为滚动基线，
+// 可注入下一期的 Baseline 字段。历史不足 window 期时使用全部历史；缺失的分量不参与平均，
+// 窗口内全部缺失时该分量为 nil。window 不为正或 history 为空时返回空 Result。
+func MovingBaseline(history []ContextInput, window int) Result {
+	if window <= 0 || len(history) == 0 {
+		return Result{}
+	}
+	if len(history) > window {
+		history = history[len(history)-window:]
+	}
+	average := func(component func(ContextInput) *OptionalFloat) *OptionalFloat {
+		vals := make([]*OptionalDecimal, 0, len(history))
+		for _, m := range history {
+			if v := component(m); v != nil {
+				vals = append(vals, NewOptionalDecimal(decimal.NewFromFloat(float64(*v))))
+			}
+		}
+		avg := AvgOptionalDecimals(vals)
+		if avg == nil {
+			return nil
+		}
+		f, _ := avg.Decimal().Float64()
+		return NewOptionalFloat(f)
+	}
+	return Result{
+		Q: average(func(m ContextInput) *OptionalFloat { return m.ObservedQ }),
+		P: average(func(m ContextInput) *OptionalFloat { return m.ObservedP }),
+		V: average(func(m ContextInput) *OptionalFloat { return m.ObservedV }),
+	}
+}
+
+// ResultsEqualWithin 比较两组结果是否一致：键集合必须相同，float64 结果按 tolerances 中对应节点的
+// 绝对误差比较（未配置时要求十进制精确相等），其他类型的结果要求完全相等。
+func ResultsEqualWithin(a, b map[string]interface{}, tolerances map[string]float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, av := range a {
+		bv, ok := b[key]
+		if !ok {
+			return false
+		}
+		af, aIsFloat := av.(float64)
+		bf, bIsFloat := bv.(float64)
+		if !aIsFloat || !bIsFloat {
+			if !reflect.DeepEqual(av, bv) {
+				return false
+			}
+			continue
+		}
+		if math.IsNaN(af) || math.IsNaN(bf) || math.IsInf(af, 0) || math.IsInf(bf, 0) {
+			if !(math.IsNaN(af) && math.IsNaN(bf)) && af != bf {
+				return false
+			}
+			continue
+		}
+		if math.Abs(utils.DecimalSubtract(af, bf)) > tolerances[key] {
+			return false
+		}
+	}
+	return true
+}
+
+// Tolerances 收集模板中声明了 Tolerance 的公式节点，供 ResultsEqualWithin 使用。
+func (t *CalcTemplate) Tolerances() map[string]float64 {
+	tolerances := make(map[string]float64)
+	for name, n := range t.registry {
+		if formula, ok := unwrapFormula(n); ok && formula.Tolerance > 0 {
+			tolerances[name] = formula.Tolerance
+		}
+	}
+	return tolerances
+}
+
+// ContributionBreakdown 返回各组成部分占 total 的百分比（保留 places 位小数），key 的写法同 ResultValue。
+// total 为零或任一部分缺失时返回错误；各部分之和不必恰好等于 total。
+func ContributionBreakdown(prev map[string]interface{}, total string, parts []string, places int) (map[string]float64, error) {
+	totalValue, err := ResultValue(prev, total)
+	if err != nil {
+		return nil, err
+	}
+	if utils.DecimalIsZero(totalValue) {
+		return nil, fmt.Errorf("total %s is zero", total)
+	}
+	shares := make(map[string]float64, len(parts))
+	for _, part := range parts {
+		value, err := ResultValue(prev, part)
+		if err != nil {
+			return nil, err
+		}
+		shares[part] = utils.DecimalDivide(utils.DecimalMul(value, 100), totalValue, places)
+	}
+	return shares, nil
+}
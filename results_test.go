@@ -0,0 +1,317 @@
+package dynamicformula
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/force-c/dynamic-formula/utils"
+)
+
+func TestMarginalCost_SamplePeriods(t *testing.T) {
+	inputs := samplePeriodInputs()
+	template := NewFullCalcTemplate()
+
+	prev, err := inputs[0].Calc(template, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	curr, err := inputs[1].Calc(template, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := MarginalCost(prev, curr, KeyAggregateMetrics+".Q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deltaCost := utils.DecimalSubtract(curr[KeyTotalCost].(float64), prev[KeyTotalCost].(float64))
+	want := utils.DecimalDivide(deltaCost, utils.DecimalSubtract(1.1, 0.8), 4)
+	if got != want {
+		t.Fatalf("marginal cost = %v, want %v", got, want)
+	}
+
+	if _, err := MarginalCost(prev, prev, KeyAggregateMetrics+".Q"); err == nil {
+		t.Fatal("expected error for unchanged quantity")
+	}
+}
+
+func TestResultValue_Forms(t *testing.T) {
+	results := map[string]interface{}{
+		"scalar": 1.5,
+		"triple": "{0.8, <nil>, 16}",
+		"raw":    Result{Q: NewOptionalFloat(2)},
+	}
+	if v, err := ResultValue(results, "scalar"); err != nil || v != 1.5 {
+		t.Errorf("scalar = %v, %v", v, err)
+	}
+	if v, err := ResultValue(results, "triple.V"); err != nil || v != 16 {
+		t.Errorf("triple.V = %v, %v", v, err)
+	}
+	if _, err := ResultValue(results, "triple.P"); err == nil {
+		t.Error("expected error for nil component")
+	}
+	if v, err := ResultValue(results, "raw.Q"); err != nil || v != 2 {
+		t.Errorf("raw.Q = %v, %v", v, err)
+	}
+	if _, err := ResultValue(results, "missing"); err == nil {
+		t.Error("expected error for missing key")
+	}
+}
+
+func TestResultMedian_UnitYield(t *testing.T) {
+	template := NewFullCalcTemplate()
+	var results []map[string]interface{}
+	for _, input := range samplePeriodInputs() {
+		data, err := input.Calc(template, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, data)
+	}
+	results[2][KeyUnitYield] = "0.18"
+
+	median, err := ResultMedian(results, KeyUnitYield)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if median != 0.14 {
+		t.Fatalf("median unit_yield = %v, want 0.14", median)
+	}
+	q, err := ResultQuantile(results, KeyUnitYield, 0.25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q != 0.1 {
+		t.Fatalf("q0.25 unit_yield = %v, want 0.1", q)
+	}
+	if q, err := ResultQuantile(results, KeyUnitYield, 1); err != nil || q != 0.18 {
+		t.Fatalf("q1 unit_yield = %v, %v", q, err)
+	}
+
+	if _, err := ResultMedian(nil, KeyUnitYield); err == nil {
+		t.Fatal("expected error for empty input")
+	}
+	if _, err := ResultQuantile(results, KeyUnitYield, 1.5); err == nil {
+		t.Fatal("expected error for out-of-range quantile")
+	}
+}
+
+func TestWithBaselineFromResults(t *testing.T) {
+	inputs := samplePeriodInputs()
+	prev, err := inputs[0].Calc(NewFullCalcTemplate(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := inputs[1].WithBaselineFromResults(prev)
+	for _, c := range []struct {
+		name string
+		got  *OptionalFloat
+		want *OptionalFloat
+	}{
+		{"BaselineQ", next.BaselineQ, inputs[0].AggregateQ},
+		{"BaselineP", next.BaselineP, inputs[0].AggregateP},
+		{"BaselineV", next.BaselineV, inputs[0].AggregateV},
+	} {
+		if c.got == nil || c.want == nil || *c.got != *c.want {
+			t.Fatalf("%s = %v, want %v", c.name, formatOptional(c.got), formatOptional(c.want))
+		}
+	}
+	if inputs[1].BaselineQ == next.BaselineQ {
+		t.Fatal("original context must not be modified")
+	}
+	if _, err := next.Calc(NewFullCalcTemplate(), false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResultsEqualWithin(t *testing.T) {
+	node := RatioNode("tolerant_ratio", KeyNetMargin, KeyTotalCost, 6)
+	node.Tolerance = 1e-4
+	template := NewCalcTemplate(node)
+	tolerances := template.Tolerances()
+	if tolerances["tolerant_ratio"] != 1e-4 || len(tolerances) != 1 {
+		t.Fatalf("tolerances = %v", tolerances)
+	}
+
+	base, err := samplePeriodInputs()[0].Calc(template, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	near := make(map[string]interface{}, len(base))
+	for k, v := range base {
+		near[k] = v
+	}
+	near["tolerant_ratio"] = utils.DecimalAdd(base["tolerant_ratio"].(float64), 0.00005)
+	if !ResultsEqualWithin(base, near, tolerances) {
+		t.Fatal("sub-tolerance difference should compare equal")
+	}
+
+	near["tolerant_ratio"] = utils.DecimalAdd(base["tolerant_ratio"].(float64), 0.001)
+	if ResultsEqualWithin(base, near, tolerances) {
+		t.Fatal("difference above tolerance should not compare equal")
+	}
+
+	near["tolerant_ratio"] = base["tolerant_ratio"]
+	near[KeyNetMargin] = utils.DecimalAdd(base[KeyNetMargin].(float64), 1e-9)
+	if ResultsEqualWithin(base, near, tolerances) {
+		t.Fatal("nodes without tolerance must match exactly")
+	}
+
+	delete(near, KeyNetMargin)
+	if ResultsEqualWithin(base, near, tolerances) {
+		t.Fatal("missing keys must not compare equal")
+	}
+}
+
+func TestContributionBreakdown(t *testing.T) {
+	results, err := samplePeriodInputs()[0].Calc(NewFullCalcTemplate(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shares, err := ContributionBreakdown(results, KeyTotalCost, []string{KeyBaseCost, KeySettlementImpact}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 15.155 / 15.4 = 98.409...%，0.245 / 15.4 = 1.590...%。
+	if shares[KeyBaseCost] != 98.4091 || shares[KeySettlementImpact] != 1.5909 {
+		t.Fatalf("shares = %v", shares)
+	}
+	if sum := utils.DecimalAdd(shares[KeyBaseCost], shares[KeySettlementImpact]); sum != 100 {
+		t.Fatalf("shares sum to %v, want 100", sum)
+	}
+
+	if _, err := ContributionBreakdown(results, KeyTotalCost, []string{"missing"}, 4); err == nil {
+		t.Fatal("expected error for missing part")
+	}
+	results["zero_total"] = 0.0
+	if _, err := ContributionBreakdown(results, "zero_total", []string{KeyBaseCost}, 4); err == nil {
+		t.Fatal("expected error for zero total")
+	}
+}
+
+func TestMovingBaseline(t *testing.T) {
+	history := samplePeriodInputs()[:2]
+	baseline := MovingBaseline(history, 2)
+	want := [3]float64{0.95, 19.85, 18.955}
+	for i, got := range []*OptionalFloat{baseline.Q, baseline.P, baseline.V} {
+		if got == nil || float64(*got) != want[i] {
+			t.Errorf("component %d = %v, want %v", i, formatOptional(got), want[i])
+		}
+	}
+
+	// 窗口只取末尾两期。
+	all := samplePeriodInputs()
+	trailing := MovingBaseline(all, 2)
+	expected := MovingBaseline(all[len(all)-2:], 2)
+	if formatCacheValue(trailing) != formatCacheValue(expected) {
+		t.Fatalf("trailing window = %s, want %s", formatCacheValue(trailing), formatCacheValue(expected))
+	}
+
+	// 历史不足窗口时使用全部历史，缺失分量不参与平均。
+	short := []ContextInput{{ObservedQ: NewOptionalFloat(0.8)}}
+	partial := MovingBaseline(short, 3)
+	if partial.Q == nil || *partial.Q != 0.8 || partial.P != nil || partial.V != nil {
+		t.Fatalf("short history baseline = %s", formatCacheValue(partial))
+	}
+	if empty := MovingBaseline(nil, 2); empty.Q != nil || empty.P != nil || empty.V != nil {
+		t.Fatalf("empty history baseline = %s", formatCacheValue(empty))
+	}
+}
+
+func TestSumResults(t *testing.T) {
+	results, err := samplePeriodInputs()[0].Calc(NewFullCalcTemplate(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := SumResults(results, []string{KeyBaseCost, KeySettlementImpact})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != results[KeyTotalCost] {
+		t.Fatalf("base_cost + settlement_impact = %v, want total_cost %v", sum, results[KeyTotalCost])
+	}
+
+	if _, err := SumResults(results, []string{KeyBaseCost, "missing"}); err == nil {
+		t.Fatal("expected error for missing key")
+	}
+	if _, err := SumResults(map[string]interface{}{"flag": true}, []string{"flag"}); err == nil {
+		t.Fatal("expected error for non-numeric result")
+	}
+}
+
+func TestCumulativeResults(t *testing.T) {
+	var periods []map[string]interface{}
+	for _, input := range samplePeriodInputs() {
+		results, err := input.Calc(NewFullCalcTemplate(), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		periods = append(periods, results)
+	}
+	// 同一键在不同期可能以数值字符串出现。
+	periods[1][KeyTotalCost] = "22.735"
+
+	got, err := CumulativeResults(periods, KeyTotalCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{15.4, 38.135, 50.15}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("cumulative total_cost = %v, want %v", got, want)
+	}
+
+	periods[2] = map[string]interface{}{}
+	if _, err := CumulativeResults(periods, KeyTotalCost); err == nil {
+		t.Fatal("expected error for missing key")
+	}
+}
+
+func TestCalcBatchReduce(t *testing.T) {
+	inputs := samplePeriodInputs()
+	template := NewFullCalcTemplate()
+
+	product := func(acc, value float64) float64 { return utils.DecimalMul(acc, value) }
+	got, err := CalcBatchReduce(template, inputs, KeyUnitYield, 1, product)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := 1.0
+	for _, input := range inputs {
+		data, err := input.Calc(template, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = utils.DecimalMul(want, data[KeyUnitYield].(float64))
+	}
+	if got != want {
+		t.Fatalf("product of unit_yield = %v, want %v", got, want)
+	}
+
+	for _, c := range []struct {
+		name    string
+		initial float64
+		fn      AggregateFunc
+		want    float64
+	}{
+		{"sum", 0, SumAgg, 50.15},
+		{"max", math.Inf(-1), MaxAgg, 22.735},
+		{"min", math.Inf(1), MinAgg, 12.015},
+	} {
+		got, err := CalcBatchReduce(template, inputs, KeyTotalCost, c.initial, c.fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("%s of total_cost = %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	if _, err := CalcBatchReduce(template, inputs, "missing", 0, SumAgg); err == nil {
+		t.Fatal("expected error for unknown key")
+	}
+	if got, err := CalcBatchReduce(template, nil, KeyTotalCost, 7, SumAgg); err != nil || got != 7 {
+		t.Fatalf("empty batch = %v, %v; want initial", got, err)
+	}
+}
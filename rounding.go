@@ -0,0 +1,115 @@
+package dynamicformula
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/force-c/dynamic-formula/utils"
+)
+
+// RoundingMode 决定模板对最终输出的舍入方式。
+type RoundingMode int
+
+const (
+	// RoundNone 不做额外舍入（默认）。
+	RoundNone RoundingMode = iota
+	// RoundHalfAwayFromZero 中点远离零进位，同 utils.DecimalRound。
+	RoundHalfAwayFromZero
+	// RoundHalfEven 银行家舍入，同 utils.DecimalRoundBank，结算报表要求使用。
+	RoundHalfEven
+	// RoundToCurrency 按 ContextInput.Meta["currency"] 的货币精度舍入量纲为 UnitValue 的公式结果，
+	// 忽略 Places；数量、价格等其他量纲的结果保持不变。
+	RoundToCurrency
+)
+
+// RoundingPolicy 是模板输出的舍入策略，只作用于写入结果的数值，下游节点读到的仍是未舍入的值。
+type RoundingPolicy struct {
+	Mode   RoundingMode
+	Places int
+}
+
+// round 按策略舍入节点 n 的输出值，NaN 与 ±Inf 无法舍入，原样返回。
+func (p RoundingPolicy) round(m ContextInput, n Node, value float64) (float64, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return value, nil
+	}
+	switch p.Mode {
+	case RoundHalfAwayFromZero:
+		return utils.DecimalRound(value, p.Places), nil
+	case RoundHalfEven:
+		return utils.DecimalRoundBank(value, p.Places), nil
+	case RoundToCurrency:
+		if formula, ok := unwrapFormula(n); !ok || formula.Unit != UnitValue {
+			return value, nil
+		}
+		code, ok := m.Meta["currency"]
+		if !ok {
+			return 0, fmt.Errorf("currency rounding requires Meta[%q]", "currency")
+		}
+		return RoundCurrency(value, code)
+	default:
+		return value, nil
+	}
+}
+
+// WithRounding 返回应用指定输出舍入策略的模板副本。
+func (t *CalcTemplate) WithRounding(policy RoundingPolicy) *CalcTemplate {
+	clone := t.clone()
+	clone.rounding = policy
+	return clone
+}
+
+// RoundPipeline 是依次作用于 Calc 结果的后处理阶段，例如展示用保留 2 位、存储用保留 6 位。
+// 内置阶段均跳过 NaN 与 ±Inf。
+type RoundPipeline []func(map[string]interface{}) map[string]interface{}
+
+// Apply 依次执行各阶段并返回最终结果，不修改传入的 results。
+func (p RoundPipeline) Apply(results map[string]interface{}) map[string]interface{} {
+	out := mapFloats(results, func(f float64) float64 { return f })
+	for _, stage := range p {
+		out = stage(out)
+	}
+	return out
+}
+
+// mapFloats 返回 results 的副本，其中有限的 float64 结果经 fn 变换，NaN、±Inf 与其他类型原样保留。
+func mapFloats(results map[string]interface{}, fn func(float64) float64) map[string]interface{} {
+	out := make(map[string]interface{}, len(results))
+	for k, v := range results {
+		if f, ok := v.(float64); ok && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			out[k] = fn(f)
+		} else {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// RoundStage 返回按 places 位小数做中点远离零舍入的阶段。
+func RoundStage(places int) func(map[string]interface{}) map[string]interface{} {
+	return func(results map[string]interface{}) map[string]interface{} {
+		return mapFloats(results, func(f float64) float64 { return utils.DecimalRound(f, places) })
+	}
+}
+
+// BankRoundStage 返回按 places 位小数做银行家舍入的阶段。
+func BankRoundStage(places int) func(map[string]interface{}) map[string]interface{} {
+	return func(results map[string]interface{}) map[string]interface{} {
+		return mapFloats(results, func(f float64) float64 { return utils.DecimalRoundBank(f, places) })
+	}
+}
+
+// ClampStage 返回把数值限制在 [lo, hi] 内的阶段，NaN 与 ±Inf 保持不变。
+func ClampStage(lo, hi float64) func(map[string]interface{}) map[string]interface{} {
+	return func(results map[string]interface{}) map[string]interface{} {
+		return mapFloats(results, func(f float64) float64 {
+			if f < lo {
+				return lo
+			}
+			if f > hi {
+				return hi
+			}
+			return f
+		})
+	}
+}
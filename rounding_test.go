@@ -0,0 +1,96 @@
+package dynamicformula
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestCalcTemplate_WithRounding(t *testing.T) {
+	half := FormulaNode{name: "half_value", formula: func(ContextInput, map[string]interface{}) (float64, error) {
+		return 2.5, nil
+	}}
+	doubled := FormulaNode{name: "half_doubled", deps: []string{"half_value"}, formula: func(_ ContextInput, prev map[string]interface{}) (float64, error) {
+		return prev["half_value"].(float64) * 2, nil
+	}}
+	template := NewCalcTemplate(half, doubled)
+
+	bank, err := ContextInput{}.Calc(template.WithRounding(RoundingPolicy{Mode: RoundHalfEven}), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertResultClose(t, bank, "half_value", 2, 0)
+	// 下游节点基于未舍入的 2.5 计算。
+	AssertResultClose(t, bank, "half_doubled", 5, 0)
+
+	halfUp, err := ContextInput{}.Calc(template.WithRounding(RoundingPolicy{Mode: RoundHalfAwayFromZero}), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertResultClose(t, halfUp, "half_value", 3, 0)
+
+	plain, err := ContextInput{}.Calc(template, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertResultClose(t, plain, "half_value", 2.5, 0)
+}
+
+func TestRoundPipeline(t *testing.T) {
+	results := map[string]interface{}{
+		"low":    -3.2,
+		"mid":    1.23456,
+		"high":   12.5,
+		"half":   0.125,
+		"result": "{1, 2, 3}",
+	}
+	pipeline := RoundPipeline{ClampStage(-1, 10), RoundStage(2)}
+	got := pipeline.Apply(results)
+	want := map[string]interface{}{
+		"low":    -1.0,
+		"mid":    1.23,
+		"high":   10.0,
+		"half":   0.13,
+		"result": "{1, 2, 3}",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Apply = %v, want %v", got, want)
+	}
+	if results["mid"] != 1.23456 {
+		t.Fatal("Apply must not modify the input results")
+	}
+
+	if got := (RoundPipeline{BankRoundStage(2)}).Apply(results); got["half"] != 0.12 {
+		t.Fatalf("bank rounding half = %v, want 0.12", got["half"])
+	}
+
+	nonFinite := map[string]interface{}{"nan": math.NaN(), "inf": math.Inf(1), "mid": 1.23456}
+	got = (RoundPipeline{RoundStage(2), BankRoundStage(1), ClampStage(0, 1)}).Apply(nonFinite)
+	if v := got["nan"].(float64); !math.IsNaN(v) {
+		t.Fatalf("nan = %v, want NaN", v)
+	}
+	if v := got["inf"].(float64); !math.IsInf(v, 1) {
+		t.Fatalf("inf = %v, want +Inf", v)
+	}
+	if got["mid"] != 1.0 {
+		t.Fatalf("mid = %v, want 1", got["mid"])
+	}
+}
+
+func TestCalcTemplate_WithRounding_MissingAsNaN(t *testing.T) {
+	input := samplePeriodInputs()[0]
+	input.BaselineV = nil
+	template := NewFullCalcTemplate()
+
+	// settlement_impact 为 0.245，恰好位于两种舍入方式的分歧点。
+	for mode, settlement := range map[RoundingMode]float64{RoundHalfAwayFromZero: 0.25, RoundHalfEven: 0.24} {
+		data, err := input.CalcWithOptions(template.WithRounding(RoundingPolicy{Mode: mode, Places: 2}), CalcOptions{MissingAsNaN: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, ok := data[KeyTotalCost].(float64); !ok || !math.IsNaN(v) {
+			t.Errorf("mode %d: total_cost = %v, want NaN", mode, data[KeyTotalCost])
+		}
+		AssertResultClose(t, data, KeySettlementImpact, settlement, 0)
+	}
+}
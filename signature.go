@@ -0,0 +1,96 @@
+package dynamicformula
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RegistrySignature 返回全局注册表中每个节点名到其 Requires() 哈希的映射。
+// 闭包无法比较，因此签名只反映节点名与依赖关系的变化。
+func RegistrySignature() map[string]string {
+	snapshot := currentRegistries()
+	signature := make(map[string]string, len(snapshot.inputs)+len(snapshot.formulas))
+	for name, n := range snapshot.inputs {
+		signature[name] = hashRequires(n.Requires())
+	}
+	for name, n := range snapshot.formulas {
+		signature[name] = hashRequires(n.Requires())
+	}
+	return signature
+}
+
+func hashRequires(deps []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(deps, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// DiffRegistries 比较两个注册表签名，返回新增、移除与依赖发生变化的节点名（均已排序）。
+func DiffRegistries(a, b map[string]string) (added, removed, changed []string) {
+	for name, hash := range b {
+		old, ok := a[name]
+		if !ok {
+			added = append(added, name)
+		} else if old != hash {
+			changed = append(changed, name)
+		}
+	}
+	for name := range a {
+		if _, ok := b[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
+
+// structuralSignature 按节点名排序拼接模板中每个节点的名称、种类与依赖，作为结构比较的规范形式。
+func (t *CalcTemplate) structuralSignature() string {
+	names := make([]string, 0, len(t.registry))
+	for name := range t.registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		n := t.registry[name]
+		b.WriteString(name)
+		b.WriteString("|")
+		b.WriteString(nodeKind(n))
+		b.WriteString("|")
+		b.WriteString(strings.Join(n.Requires(), ","))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// nodeKind 返回节点种类，输入节点统一为 input，其余节点使用其具体类型名。
+func nodeKind(n Node) string {
+	if isInputNode(n) {
+		return "input"
+	}
+	return fmt.Sprintf("%T", n)
+}
+
+// StructuralHash 返回模板依赖图的结构哈希，只覆盖节点名、种类与依赖，不涉及公式闭包。
+func (t *CalcTemplate) StructuralHash() string {
+	sum := sha256.Sum256([]byte(t.structuralSignature()))
+	return hex.EncodeToString(sum[:])
+}
+
+// EquivalentTo 判断两个模板的依赖图在结构上是否相同。由于闭包无法比较，
+// 结构等价并不保证计算语义相同：同名节点替换了公式实现时仍会被视为等价。
+func (t *CalcTemplate) EquivalentTo(other *CalcTemplate) bool {
+	if other == nil {
+		return false
+	}
+	if t.StructuralHash() != other.StructuralHash() {
+		return false
+	}
+	return t.structuralSignature() == other.structuralSignature()
+}
@@ -0,0 +1,56 @@
+package dynamicformula
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffRegistries_DetectsChangedDeps(t *testing.T) {
+	preserveRegistries(t)
+
+	constant := func(m ContextInput, prev map[string]interface{}) (float64, error) { return 1, nil }
+	RegisterFormula(FormulaNode{name: "signature_probe", deps: []string{KeyBaseCost}, formula: constant})
+	before := RegistrySignature()
+
+	RegisterFormula(FormulaNode{name: "signature_probe", deps: []string{KeyBaseCost, KeyTotalCost}, formula: constant})
+	RegisterFormula(FormulaNode{name: "signature_probe_added", deps: []string{KeyBaseCost}, formula: constant})
+	after := RegistrySignature()
+
+	added, removed, changed := DiffRegistries(before, after)
+	if !reflect.DeepEqual(added, []string{"signature_probe_added"}) {
+		t.Errorf("added = %v", added)
+	}
+	if len(removed) != 0 {
+		t.Errorf("removed = %v", removed)
+	}
+	if !reflect.DeepEqual(changed, []string{"signature_probe"}) {
+		t.Errorf("changed = %v", changed)
+	}
+
+	_, removed, _ = DiffRegistries(after, before)
+	if !reflect.DeepEqual(removed, []string{"signature_probe_added"}) {
+		t.Errorf("reverse diff removed = %v", removed)
+	}
+}
+
+func TestCalcTemplate_EquivalentTo(t *testing.T) {
+	full := NewFullCalcTemplate()
+	byOutputs, err := TemplateFor(KeyUnitYield, KeyTotalCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !full.EquivalentTo(byOutputs) {
+		t.Fatal("templates covering the same graph should be equivalent")
+	}
+	if full.StructuralHash() != byOutputs.StructuralHash() {
+		t.Fatal("equivalent templates should share a structural hash")
+	}
+
+	partial := NewCalcTemplate(currentRegistries().formulas[KeyTotalCost])
+	if full.EquivalentTo(partial) {
+		t.Fatal("a sub-graph must not be equivalent to the full template")
+	}
+	if full.EquivalentTo(nil) {
+		t.Fatal("nil template must not be equivalent")
+	}
+}
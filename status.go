@@ -0,0 +1,111 @@
+package dynamicformula
+
+import "fmt"
+
+// Status 描述容错公式结果的可信程度。
+type Status int
+
+const (
+	// StatusOK 表示结果完整可信。
+	StatusOK Status = iota
+	// StatusDegraded 表示结果可用但基于缺省或近似输入。
+	StatusDegraded
+	// StatusFailed 表示结果不可用。CalcWithStatus 中节点不会出现在结果中，普通下游节点随之标记为失败并跳过；
+	// 其他 Calc 接口没有状态可供调用方察觉，会返回错误。
+	StatusFailed
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusOK:
+		return "ok"
+	case StatusDegraded:
+		return "degraded"
+	case StatusFailed:
+		return "failed"
+	default:
+		return fmt.Sprintf("status(%d)", int(s))
+	}
+}
+
+// StatusResult 是容错公式的输出：数值、状态与可选说明。
+type StatusResult struct {
+	Value  float64
+	Status Status
+	Note   string
+}
+
+// StatusFormula 计算容错公式，upstream 为各依赖的状态（输入节点不记录状态）。
+type StatusFormula func(m ContextInput, prev map[string]interface{}, upstream map[string]Status) StatusResult
+
+// statusComputer 由容错公式节点实现，evaluate 据此收集状态而不是在失败时中止。
+type statusComputer interface {
+	computeStatus(m ContextInput, done map[string]interface{}, statuses map[string]Status) StatusResult
+}
+
+// statusFormulaNode 是输出 StatusResult 的公式节点，下游读到的依赖值仍是 float64。
+type statusFormulaNode struct {
+	name    string
+	deps    []string
+	formula StatusFormula
+}
+
+// StatusFormulaNode 构造容错公式节点。
+func StatusFormulaNode(name string, deps []string, fn StatusFormula) Node {
+	return statusFormulaNode{name: name, deps: deps, formula: fn}
+}
+
+// RegisterStatusFormula 将容错公式节点写入全局注册表。
+func RegisterStatusFormula(name string, deps []string, fn StatusFormula) {
+	node := StatusFormulaNode(name, deps, fn)
+	updateRegistries(func(formulas, _ map[string]Node) {
+		formulas[name] = node
+	})
+}
+
+func (n statusFormulaNode) Name() string { return n.name }
+
+func (statusFormulaNode) formulaOutput() {}
+
+func (n statusFormulaNode) Requires() []string { return n.deps }
+
+// Compute 供直接调用节点的场景使用：失败状态转为错误，依赖状态视为 OK。
+func (n statusFormulaNode) Compute(m ContextInput, done map[string]interface{}) (interface{}, error) {
+	res := n.computeStatus(m, done, nil)
+	if res.Status == StatusFailed {
+		return nil, fmt.Errorf("status formula %s failed: %s", n.name, res.Note)
+	}
+	return res.Value, nil
+}
+
+func (n statusFormulaNode) computeStatus(m ContextInput, done map[string]interface{}, statuses map[string]Status) StatusResult {
+	upstream := make(map[string]Status, len(n.deps))
+	for _, dep := range n.deps {
+		if status, ok := statuses[dep]; ok {
+			upstream[dep] = status
+		}
+	}
+	return n.formula(m, done, upstream)
+}
+
+// worstStatus 返回 deps 中最差的状态，没有记录时为 StatusOK。
+func worstStatus(deps []string, statuses map[string]Status) Status {
+	worst := StatusOK
+	for _, dep := range deps {
+		if status := statuses[dep]; status > worst {
+			worst = status
+		}
+	}
+	return worst
+}
+
+// CalcWithStatus 按容错语义计算模板：容错公式的失败不会中止计算，
+// 额外返回每个公式节点的状态，普通公式继承其依赖中最差的状态。
+func (m ContextInput) CalcWithStatus(t *CalcTemplate, opts CalcOptions) (map[string]interface{}, map[string]Status, error) {
+	opts.tolerateFailures = true
+	run, err := m.evaluate(t, opts, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return run.results, run.statuses, nil
+}
@@ -0,0 +1,102 @@
+package dynamicformula
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/force-c/dynamic-formula/utils"
+)
+
+func TestCalcWithStatus_DegradedPropagates(t *testing.T) {
+	preserveRegistries(t)
+	RegisterStatusFormula("overhead_estimate", []string{KeyOverheadAdjusters},
+		func(m ContextInput, prev map[string]interface{}, _ map[string]Status) StatusResult {
+			overhead, _ := prev[KeyOverheadAdjusters].(Result)
+			if overhead.V == nil {
+				return StatusResult{Value: 0, Status: StatusDegraded, Note: "overhead missing, assumed zero"}
+			}
+			return StatusResult{Value: float64(*overhead.V)}
+		})
+
+	loaded := FormulaNode{
+		name: "loaded_cost",
+		deps: []string{KeyBaseCost, "overhead_estimate"},
+		formula: func(_ ContextInput, prev map[string]interface{}) (float64, error) {
+			return utils.DecimalAdd(prev[KeyBaseCost].(float64), prev["overhead_estimate"].(float64)), nil
+		},
+	}
+	flagged := StatusFormulaNode("loaded_cost_flagged", []string{"overhead_estimate"},
+		func(_ ContextInput, prev map[string]interface{}, upstream map[string]Status) StatusResult {
+			return StatusResult{Value: prev["overhead_estimate"].(float64), Status: upstream["overhead_estimate"]}
+		})
+	template := NewCalcTemplate(loaded, flagged)
+
+	input := samplePeriodInputs()[0]
+	data, statuses, err := input.CalcWithStatus(template, CalcOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertResultClose(t, data, "loaded_cost", 15.955, 1e-9)
+	if statuses["loaded_cost"] != StatusOK || statuses[KeyBaseCost] != StatusOK {
+		t.Fatalf("statuses = %v, want all ok", statuses)
+	}
+
+	input.OverheadV = nil
+	data, statuses, err = input.CalcWithStatus(template, CalcOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertResultClose(t, data, "loaded_cost", 15.155, 1e-9)
+	for _, name := range []string{"overhead_estimate", "loaded_cost", "loaded_cost_flagged"} {
+		if statuses[name] != StatusDegraded {
+			t.Errorf("status of %s = %v, want degraded", name, statuses[name])
+		}
+	}
+	if statuses[KeyBaseCost] != StatusOK {
+		t.Errorf("base_cost status = %v, want ok", statuses[KeyBaseCost])
+	}
+}
+
+func TestCalcWithStatus_FailedSkipsDownstream(t *testing.T) {
+	failing := StatusFormulaNode("always_failing", []string{KeyBaseCost},
+		func(ContextInput, map[string]interface{}, map[string]Status) StatusResult {
+			return StatusResult{Status: StatusFailed, Note: "source offline"}
+		})
+	downstream := RatioNode("failing_ratio", "always_failing", KeyBaseCost, 4)
+	data, statuses, err := samplePeriodInputs()[0].CalcWithStatus(NewCalcTemplate(failing, downstream), CalcOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := data["failing_ratio"]; ok {
+		t.Fatal("downstream of a failed node must be skipped")
+	}
+	if statuses["always_failing"] != StatusFailed || statuses["failing_ratio"] != StatusFailed {
+		t.Fatalf("statuses = %v", statuses)
+	}
+	if StatusDegraded.String() != "degraded" {
+		t.Fatalf("String() = %q", StatusDegraded.String())
+	}
+}
+
+func TestCalc_FailedStatusReturnsError(t *testing.T) {
+	failing := StatusFormulaNode("always_failing", []string{KeyBaseCost},
+		func(ContextInput, map[string]interface{}, map[string]Status) StatusResult {
+			return StatusResult{Status: StatusFailed, Note: "source offline"}
+		})
+	downstream := RatioNode("failing_ratio", "always_failing", KeyBaseCost, 4)
+	template := NewCalcTemplate(failing, downstream)
+	input := samplePeriodInputs()[0]
+
+	_, err := input.Calc(template, false)
+	var nodeErr *NodeComputeError
+	if !errors.As(err, &nodeErr) || nodeErr.Node != "always_failing" {
+		t.Fatalf("Calc error = %v, want failure of always_failing", err)
+	}
+	if !strings.Contains(err.Error(), "source offline") {
+		t.Fatalf("error %q should carry the status note", err)
+	}
+	if _, err := input.CalcReport(template, CalcOptions{}); err == nil {
+		t.Fatal("CalcReport must not silently drop failed nodes")
+	}
+}
@@ -0,0 +1,87 @@
+package dynamicformula
+
+import (
+	"context"
+	"fmt"
+)
+
+// CalcStreamResult 是 CalcBatchOrderedStream 输出的单期结果。
+type CalcStreamResult struct {
+	// Index 是该期在输入切片中的下标。
+	Index int
+	// Period 是该期的 ContextInput.Period。
+	Period int
+	// Results 是 CalcWithOptions 的输出，Err 非 nil 时为 nil。
+	Results map[string]interface{}
+	Err     error
+}
+
+// CalcBatchOrderedStream 以最多 maxWorkers 个并发计算各期，并严格按输入顺序输出结果：先完成的后续期次被缓冲，
+// 直到前面的期次全部输出。缓冲区有界，最多 2×maxWorkers 期处于计算中或等待输出；较慢的早期期次会让后续调度暂停，
+// 但它本身总已在计算中，因此不会死锁。某期失败时其 Err 非 nil，其余期次照常输出。
+// ctx 取消后停止调度并提前关闭通道，已开始的计算在完成后丢弃。maxWorkers 小于 1 时按 1 处理。
+func CalcBatchOrderedStream(ctx context.Context, t *CalcTemplate, inputs []ContextInput, maxWorkers int) <-chan CalcStreamResult {
+	if maxWorkers < 1 {
+		maxWorkers = 1
+	}
+	window := 2 * maxWorkers
+	out := make(chan CalcStreamResult)
+	jobs := make(chan int)
+	// slots 限制已调度但尚未输出的期数，completed 的容量与之相同，因此 worker 写入时从不阻塞。
+	slots := make(chan struct{}, window)
+	completed := make(chan CalcStreamResult, window)
+
+	go func() {
+		defer close(jobs)
+		for i := range inputs {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for w := 0; w < maxWorkers; w++ {
+		go func() {
+			for i := range jobs {
+				input := inputs[i]
+				r := CalcStreamResult{Index: i, Period: input.Period}
+				r.Results, r.Err = input.CalcWithOptions(t, CalcOptions{})
+				if r.Err != nil {
+					r.Err = fmt.Errorf("period %d (index %d): %w", input.Period, i, r.Err)
+				}
+				completed <- r
+			}
+		}()
+	}
+
+	go func() {
+		defer close(out)
+		pending := make(map[int]CalcStreamResult, window)
+		for next := 0; next < len(inputs); {
+			select {
+			case r := <-completed:
+				pending[r.Index] = r
+			case <-ctx.Done():
+				return
+			}
+			for r, ok := pending[next]; ok; r, ok = pending[next] {
+				select {
+				case out <- r:
+				case <-ctx.Done():
+					return
+				}
+				delete(pending, next)
+				<-slots
+				next++
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,75 @@
+package dynamicformula
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// sleepyPeriodTemplate 返回一个按期次休眠不同时长后输出期次值的模板。
+func sleepyPeriodTemplate(delays []time.Duration) *CalcTemplate {
+	return NewCalcTemplate(FormulaNode{
+		name: "slow_period",
+		deps: []string{KeyPeriod},
+		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
+			time.Sleep(delays[m.Period])
+			return float64(*prev[KeyPeriod].(Result).Q), nil
+		},
+	})
+}
+
+func TestCalcBatchOrderedStream_PreservesOrder(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	const n = 24
+	delays := make([]time.Duration, n)
+	inputs := make([]ContextInput, n)
+	for i := range inputs {
+		delays[i] = time.Duration(rng.Intn(5)) * time.Millisecond
+		inputs[i] = ContextInput{Period: i}
+	}
+	// 首期最慢，后续期次必须被缓冲而不是越过它输出。
+	delays[0] = 30 * time.Millisecond
+
+	next := 0
+	for r := range CalcBatchOrderedStream(context.Background(), sleepyPeriodTemplate(delays), inputs, 4) {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		if r.Index != next || r.Period != next {
+			t.Fatalf("got index %d period %d, want %d", r.Index, r.Period, next)
+		}
+		if r.Results["slow_period"] != float64(next) {
+			t.Fatalf("period %d results = %v", next, r.Results)
+		}
+		next++
+	}
+	if next != n {
+		t.Fatalf("received %d results, want %d", next, n)
+	}
+}
+
+func TestCalcBatchOrderedStream_Cancel(t *testing.T) {
+	inputs := make([]ContextInput, 50)
+	delays := make([]time.Duration, len(inputs))
+	for i := range inputs {
+		inputs[i] = ContextInput{Period: i}
+		delays[i] = time.Millisecond
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := CalcBatchOrderedStream(ctx, sleepyPeriodTemplate(delays), inputs, 2)
+	<-stream
+	cancel()
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-stream:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("stream not closed after cancel")
+		}
+	}
+}
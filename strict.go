@@ -0,0 +1,43 @@
+package dynamicformula
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUndeclaredDependency 表示严格模式下节点读取了未在 Requires 中声明的依赖结果。
+var ErrUndeclaredDependency = errors.New("undeclared dependency")
+
+// declaredView 返回只包含节点声明依赖与模板保留键（如模板参数）的结果视图。
+func declaredView(n Node, done map[string]interface{}) map[string]interface{} {
+	view := make(map[string]interface{}, len(n.Requires())+2)
+	for _, dep := range n.Requires() {
+		if v, ok := done[dep]; ok {
+			view[dep] = v
+		}
+	}
+	for _, key := range []string{paramsKey, zeroDenominatorKey, templateStackKey} {
+		if v, ok := done[key]; ok {
+			view[key] = v
+		}
+	}
+	return view
+}
+
+// checkDeclaredDeps 用只含声明依赖的视图重新计算节点，与正式结果 res 对比：
+// 重算失败或结果不同说明节点读取了未声明的依赖。Go 的 map 读取无法拦截，因此以重算代替守卫，
+// 节点在严格模式下会被计算两次；History 装饰器只重算被包装的节点，避免重复记录。
+func (m ContextInput) checkDeclaredDeps(n Node, done map[string]interface{}, res interface{}) error {
+	probe := n
+	if h, ok := n.(historyNode); ok {
+		probe = h.Node
+	}
+	got, err := probe.Compute(m, declaredView(n, done))
+	if err != nil {
+		return fmt.Errorf("%w: fails with only declared dependencies %v: %v", ErrUndeclaredDependency, n.Requires(), err)
+	}
+	if formatCacheValue(got) != formatCacheValue(res) {
+		return fmt.Errorf("%w: result changes when restricted to declared dependencies %v", ErrUndeclaredDependency, n.Requires())
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package dynamicformula
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestCalcOptions_StrictDeps(t *testing.T) {
+	input := samplePeriodInputs()[0]
+	full := NewFullCalcTemplateWithOptions(FullTemplateOptions{IncludeOverhead: true})
+	if _, err := input.CalcWithOptions(full, CalcOptions{StrictDeps: true}); err != nil {
+		t.Fatalf("built-in formulas must declare their dependencies: %v", err)
+	}
+
+	// 只声明 total_cost，却读取了 base_cost：非严格模式下因执行顺序恰好可用而悄悄成功。
+	sneaky := FormulaNode{
+		name: "sneaky",
+		deps: []string{KeyTotalCost},
+		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
+			base, ok := prev[KeyBaseCost].(float64)
+			if !ok {
+				return 0, fmt.Errorf("base cost is unavailable")
+			}
+			return prev[KeyTotalCost].(float64) - base, nil
+		},
+	}
+	template := NewCalcTemplate(sneaky)
+	if _, err := input.Calc(template, false); err != nil {
+		t.Fatalf("non-strict: %v", err)
+	}
+	_, err := input.CalcWithOptions(template, CalcOptions{StrictDeps: true})
+	var nodeErr *NodeComputeError
+	if !errors.Is(err, ErrUndeclaredDependency) || !errors.As(err, &nodeErr) || nodeErr.Node != "sneaky" {
+		t.Fatalf("expected undeclared dependency error for sneaky, got %v", err)
+	}
+
+	// 容忍缺失的读取同样被发现：结果在受限视图下发生变化。
+	tolerant := FormulaNode{
+		name: "tolerant",
+		deps: []string{KeyTotalCost},
+		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
+			base, _ := prev[KeyBaseCost].(float64)
+			return prev[KeyTotalCost].(float64) + base, nil
+		},
+	}
+	if _, err := input.CalcWithOptions(NewCalcTemplate(tolerant), CalcOptions{StrictDeps: true}); !errors.Is(err, ErrUndeclaredDependency) {
+		t.Fatalf("expected undeclared dependency error for tolerant, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package dynamicformula
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// ErrRecursiveSubTemplate 表示子模板直接或间接地嵌套了正在执行的外层模板。
+var ErrRecursiveSubTemplate = errors.New("recursive sub-template")
+
+// templateStackKey 是执行中外层模板结构哈希栈在依赖结果中的保留键，子模板节点据此跨模板检测递归。
+const templateStackKey = "$templates"
+
+// subTemplateNode 把一个内层模板封装为单个节点，计算时以同一 ContextInput 运行内层模板。
+type subTemplateNode struct {
+	name      string
+	template  *CalcTemplate
+	outputKey string
+	inputs    []string
+}
+
+// SubTemplateNode 将模板 t 封装为名为 name 的节点，节点结果为内层 outputKey 的计算结果。
+// Requires 返回内层模板依赖的输入节点（构造时确定），外层模板据此调度并计算这些输入。
+func SubTemplateNode(name string, t *CalcTemplate, outputKey string) Node {
+	var inputs []string
+	for nodeName, n := range t.registry {
+		if isInputNode(n) {
+			inputs = append(inputs, nodeName)
+		}
+	}
+	sort.Strings(inputs)
+	return subTemplateNode{
+		name:      name,
+		template:  t,
+		outputKey: outputKey,
+		inputs:    inputs,
+	}
+}
+
+func (n subTemplateNode) Name() string { return n.name }
+
+func (subTemplateNode) formulaOutput() {}
+
+func (n subTemplateNode) Requires() []string { return n.inputs }
+
+func (n subTemplateNode) Compute(m ContextInput, done map[string]interface{}) (interface{}, error) {
+	stack, _ := done[templateStackKey].([]string)
+	run, err := m.evaluate(n.template, CalcOptions{templates: stack}, false)
+	if err != nil {
+		return nil, fmt.Errorf("sub-template %s: %w", n.name, err)
+	}
+	res, ok := run.done[n.outputKey]
+	run.release()
+	if !ok {
+		return nil, fmt.Errorf("sub-template %s has no output %s", n.name, n.outputKey)
+	}
+	return res, nil
+}
+
+// hasSubTemplates 判断模板是否直接包含子模板节点。
+func (t *CalcTemplate) hasSubTemplates() bool {
+	for _, n := range t.registry {
+		if _, ok := n.(subTemplateNode); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// enterTemplate 在模板结构哈希栈上压入 t，t 已在栈上时返回 ErrRecursiveSubTemplate。
+// 模板不含子模板且不在子模板内执行时无需跟踪，返回 nil 栈。
+func (t *CalcTemplate) enterTemplate(stack []string) ([]string, error) {
+	if len(stack) == 0 && !t.hasSubTemplates() {
+		return nil, nil
+	}
+	hash := t.StructuralHash()
+	if slices.Contains(stack, hash) {
+		return nil, fmt.Errorf("%w: template %s is already being evaluated", ErrRecursiveSubTemplate, hash[:12])
+	}
+	return append(slices.Clone(stack), hash), nil
+}
@@ -0,0 +1,54 @@
+package dynamicformula
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSubTemplateNode(t *testing.T) {
+	sub := SubTemplateNode("sub_unit_yield", NewFullCalcTemplate(), KeyUnitYield)
+	wantInputs := []string{KeyAggregateMetrics, KeyBaselineMetrics, KeyObservedMetrics, KeyScenarioAInputs, KeyScenarioBInputs}
+	if !reflect.DeepEqual(sub.Requires(), wantInputs) {
+		t.Fatalf("Requires() = %v, want %v", sub.Requires(), wantInputs)
+	}
+
+	template := NewCalcTemplate(sub)
+	for i, want := range []float64{0.14, 0.06, 0.18} {
+		data, err := samplePeriodInputs()[i].Calc(template, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		AssertResultClose(t, data, "sub_unit_yield", want, 1e-9)
+		if _, ok := data[KeyNetMargin]; ok {
+			t.Fatal("inner nodes must not leak into the outer results")
+		}
+	}
+
+	missing := NewCalcTemplate(SubTemplateNode("sub_missing", NewFullCalcTemplate(), "no_such_output"))
+	if _, err := samplePeriodInputs()[0].Calc(missing, false); err == nil {
+		t.Fatal("expected error for unknown sub-template output")
+	}
+}
+
+func TestSubTemplateNode_Recursive(t *testing.T) {
+	template, err := TemplateFor(KeyBaseCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 把引用模板自身的子模板节点加入该模板，形成自嵌套。
+	self := SubTemplateNode("self", template, KeyBaseCost)
+	template.registry["self"] = self
+	template.nodes = append(template.nodes, self)
+
+	_, err = samplePeriodInputs()[0].Calc(template, false)
+	if !errors.Is(err, ErrRecursiveSubTemplate) {
+		t.Fatalf("expected recursive sub-template error, got %v", err)
+	}
+
+	// 嵌套不同模板不受影响。
+	outer := NewCalcTemplate(SubTemplateNode("outer", NewCalcTemplate(SubTemplateNode("inner", NewFullCalcTemplate(), KeyTotalCost)), "inner"))
+	if _, err := samplePeriodInputs()[0].Calc(outer, false); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,71 @@
+package dynamicformula
+
+import (
+	"fmt"
+
+	"github.com/force-c/dynamic-formula/utils"
+)
+
+// SweepPoint 是敏感性曲线上的一个点。
+type SweepPoint struct {
+	Input  float64
+	Output interface{}
+}
+
+// Sweep 依次把 field 指定的上下文字段设为 values 中的每个值并执行模板，记录 outputKey 的结果，
+// 得到该输出对此字段的敏感性曲线。原上下文不会被修改。
+func (m ContextInput) Sweep(t *CalcTemplate, field string, values []float64, outputKey string) ([]SweepPoint, error) {
+	points := make([]SweepPoint, 0, len(values))
+	for _, value := range values {
+		variant := m
+		if err := variant.setOptionalField(field, value); err != nil {
+			return nil, err
+		}
+		results, err := variant.Calc(t, false)
+		if err != nil {
+			return nil, fmt.Errorf("sweep %s=%v: %w", field, value, err)
+		}
+		output, ok := results[outputKey]
+		if !ok {
+			return nil, fmt.Errorf("sweep %s=%v: result %s not found", field, value, outputKey)
+		}
+		points = append(points, SweepPoint{Input: value, Output: output})
+	}
+	return points, nil
+}
+
+// withoutScenario 返回去掉某一场景的上下文副本：该场景的数量与估值置零，价格保留，
+// 以免价格变为零改变依赖价差的公式分支。
+func (m ContextInput) withoutScenario(scenario string) ContextInput {
+	zero := NewOptionalFloat(0)
+	switch scenario {
+	case "A":
+		m.ScenarioAQ, m.ScenarioAV = zero, zero
+	case "B":
+		m.ScenarioBQ, m.ScenarioBV = zero, zero
+	}
+	return m
+}
+
+// CompareScenarios 分别在只保留场景 A（场景 B 的数量与估值置零）和只保留场景 B 的上下文中执行模板，
+// 返回 outputKey 在两种情形下的结果及其差值 aOnly - bOnly。base 不会被修改。
+func CompareScenarios(t *CalcTemplate, base ContextInput, outputKey string) (aOnly, bOnly, delta float64, err error) {
+	outcome := func(scenario string) (float64, error) {
+		results, err := base.withoutScenario(scenario).Calc(t, false)
+		if err != nil {
+			return 0, fmt.Errorf("without scenario %s: %w", scenario, err)
+		}
+		value, err := ResultValue(results, outputKey)
+		if err != nil {
+			return 0, fmt.Errorf("without scenario %s: %w", scenario, err)
+		}
+		return value, nil
+	}
+	if aOnly, err = outcome("B"); err != nil {
+		return 0, 0, 0, err
+	}
+	if bOnly, err = outcome("A"); err != nil {
+		return 0, 0, 0, err
+	}
+	return aOnly, bOnly, utils.DecimalSubtract(aOnly, bOnly), nil
+}
@@ -0,0 +1,57 @@
+package dynamicformula
+
+import "testing"
+
+func TestSweep_ScenarioAPrice(t *testing.T) {
+	input := samplePeriodInputs()[0]
+	original := input.ScenarioAP
+
+	points, err := input.Sweep(NewFullCalcTemplate(), "ScenarioAP", []float64{17, 17.5, 18}, KeySettlementImpact)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []float64{-0.28, -0.105, 0.07}
+	if len(points) != len(want) {
+		t.Fatalf("got %d points, want %d", len(points), len(want))
+	}
+	for i, point := range points {
+		if point.Output.(float64) != want[i] {
+			t.Errorf("ScenarioAP=%v: settlement_impact = %v, want %v", point.Input, point.Output, want[i])
+		}
+		if i > 0 && point.Output.(float64) <= points[i-1].Output.(float64) {
+			t.Errorf("settlement_impact should increase with ScenarioAP: %v", points)
+		}
+	}
+	if input.ScenarioAP != original || *original != 18.5 {
+		t.Fatal("Sweep modified the original context")
+	}
+
+	if _, err := input.Sweep(NewFullCalcTemplate(), "NoSuchField", []float64{1}, KeySettlementImpact); err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+}
+
+func TestCompareScenarios(t *testing.T) {
+	input := samplePeriodInputs()[0]
+	input.ScenarioBQ = nil
+	aOnly, bOnly, delta, err := CompareScenarios(NewFullCalcTemplate(), input, KeyTotalCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 只保留 A：基础成本 4.3 + 4.625，结算影响 0.245；只保留 B：基础成本 4.3 + 6.23，结算影响 0.42。
+	if aOnly != 9.17 || bOnly != 10.95 || delta != -1.78 {
+		t.Fatalf("CompareScenarios = %v, %v, %v; want 9.17, 10.95, -1.78", aOnly, bOnly, delta)
+	}
+	if input.ScenarioBQ != nil || *input.ScenarioAV != 4.625 {
+		t.Fatal("CompareScenarios modified the base context")
+	}
+
+	input.ScenarioAP = nil
+	if _, _, _, err := CompareScenarios(NewFullCalcTemplate(), input, KeyTotalCost); err == nil {
+		t.Fatal("expected error when a required price is missing")
+	}
+	if _, _, _, err := CompareScenarios(NewFullCalcTemplate(), samplePeriodInputs()[0], "no_such_output"); err == nil {
+		t.Fatal("expected error for unknown output")
+	}
+}
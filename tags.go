@@ -0,0 +1,44 @@
+package dynamicformula
+
+import (
+	"slices"
+	"sort"
+)
+
+// 内置公式的分类标签。
+const (
+	TagCost   = "cost"
+	TagMargin = "margin"
+	TagYield  = "yield"
+	TagPrice  = "price"
+)
+
+// nodeTags 返回节点的标签，装饰器包装的公式节点按被包装的节点取标签，非公式节点没有标签。
+func nodeTags(n Node) []string {
+	if formula, ok := unwrapFormula(n); ok {
+		return formula.Tags
+	}
+	return nil
+}
+
+// hasAnyTag 判断节点是否带有 tags 中的任一标签。
+func hasAnyTag(n Node, tags []string) bool {
+	for _, tag := range nodeTags(n) {
+		if slices.Contains(tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// NodesWithTag 返回模板中带有 tag 标签的节点名（已排序）。
+func (t *CalcTemplate) NodesWithTag(tag string) []string {
+	var names []string
+	for name, n := range t.registry {
+		if slices.Contains(nodeTags(n), tag) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
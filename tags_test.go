@@ -0,0 +1,50 @@
+package dynamicformula
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCalcTemplate_NodesWithTag(t *testing.T) {
+	template := NewFullCalcTemplateWithOptions(FullTemplateOptions{IncludeOverhead: true})
+	for tag, want := range map[string][]string{
+		TagCost:   {KeyBaseCost, KeyOverheadTotal, KeySettlementImpact, KeyTotalCost},
+		TagMargin: {KeyNetMargin, KeyScenarioMargin},
+		TagYield:  {KeyUnitYield},
+		"unknown": nil,
+	} {
+		if got := template.NodesWithTag(tag); !reflect.DeepEqual(got, want) {
+			t.Errorf("NodesWithTag(%q) = %v, want %v", tag, got, want)
+		}
+	}
+}
+
+func TestCalcOptions_EmitTags(t *testing.T) {
+	template := NewFullCalcTemplate()
+	input := samplePeriodInputs()[0]
+	full, err := input.Calc(template, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := input.CalcWithOptions(template, CalcOptions{IncludeInputNodes: true, EmitTags: []string{TagMargin}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 2 {
+		t.Fatalf("expected only margin nodes, got %v", data)
+	}
+	for _, key := range []string{KeyNetMargin, KeyScenarioMargin} {
+		if data[key] != full[key] {
+			t.Errorf("%s = %v, want %v", key, data[key], full[key])
+		}
+	}
+
+	data, err = input.CalcWithOptions(template, CalcOptions{EmitTags: []string{TagMargin}, EmitOnly: []string{KeyNetMargin, KeyTotalCost}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := data[KeyNetMargin]; !ok || len(data) != 1 {
+		t.Fatalf("EmitOnly and EmitTags must both apply, got %v", data)
+	}
+}
@@ -0,0 +1,59 @@
+package dynamicformula
+
+// ResultTree 是按依赖关系嵌套的计算结果，Children 为该节点各依赖的子树。
+// 依赖图中被多个节点共享的节点只在首次出现时展开，之后以 Ref 为 true、不带 Children 的引用节点表示。
+type ResultTree struct {
+	Name     string
+	Value    interface{}
+	Children []*ResultTree
+	// Ref 表示该节点已在树中更早的位置展开，此处只是引用。
+	Ref bool
+}
+
+// Find 以深度优先顺序查找首个展开（非引用）的同名节点，找不到时返回 nil。
+func (r *ResultTree) Find(name string) *ResultTree {
+	if r.Name == name && !r.Ref {
+		return r
+	}
+	for _, child := range r.Children {
+		if found := child.Find(name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// CalcTree 执行模板并把结果组织为依赖树。返回的根节点不对应任何计算节点（Name 为空），
+// 其 Children 为模板的各根节点；值的形式与 Calc 输出一致，被停用或跳过的节点不出现在树中。
+func (m ContextInput) CalcTree(t *CalcTemplate) (*ResultTree, error) {
+	run, err := m.evaluate(t, CalcOptions{IncludeInputNodes: true}, false)
+	if err != nil {
+		return nil, err
+	}
+
+	expanded := make(map[string]bool)
+	var build func(n Node) *ResultTree
+	build = func(n Node) *ResultTree {
+		tree := &ResultTree{Name: n.Name(), Value: run.results[n.Name()]}
+		if expanded[n.Name()] {
+			tree.Ref = true
+			return tree
+		}
+		expanded[n.Name()] = true
+		for _, dep := range t.depsOf(n) {
+			if _, ok := run.results[dep]; !ok {
+				continue
+			}
+			tree.Children = append(tree.Children, build(t.registry[dep]))
+		}
+		return tree
+	}
+
+	root := &ResultTree{}
+	for _, n := range t.nodes {
+		if _, ok := run.results[n.Name()]; ok {
+			root.Children = append(root.Children, build(n))
+		}
+	}
+	return root, nil
+}
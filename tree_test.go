@@ -0,0 +1,58 @@
+package dynamicformula
+
+import "testing"
+
+func TestContextInput_CalcTree(t *testing.T) {
+	input := samplePeriodInputs()[0]
+	template := NewFullCalcTemplate()
+	tree, err := input.CalcTree(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := input.Calc(template, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total := tree.Find(KeyTotalCost)
+	if total == nil {
+		t.Fatal("total_cost not found in tree")
+	}
+	if total.Value != results[KeyTotalCost] {
+		t.Fatalf("total_cost value = %v, want %v", total.Value, results[KeyTotalCost])
+	}
+	if len(total.Children) != 2 || total.Children[0].Name != KeyBaseCost || total.Children[1].Name != KeySettlementImpact {
+		t.Fatalf("total_cost children = %v", treeNames(total.Children))
+	}
+
+	// settlement_impact 同时被 total_cost 与 net_margin 依赖，只展开一次。
+	var expansions, refs int
+	var count func(*ResultTree)
+	count = func(r *ResultTree) {
+		if r.Name == KeySettlementImpact {
+			if r.Ref {
+				refs++
+				if len(r.Children) != 0 {
+					t.Errorf("reference node has children %v", treeNames(r.Children))
+				}
+			} else {
+				expansions++
+			}
+		}
+		for _, child := range r.Children {
+			count(child)
+		}
+	}
+	count(tree)
+	if expansions != 1 || refs == 0 {
+		t.Fatalf("settlement_impact expanded %d times with %d references", expansions, refs)
+	}
+}
+
+func treeNames(trees []*ResultTree) []string {
+	names := make([]string, len(trees))
+	for i, tree := range trees {
+		names[i] = tree.Name
+	}
+	return names
+}
@@ -0,0 +1,88 @@
+package dynamicformula
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// UnitQuantity 是 Result.Q 分量的约定量纲。
+	UnitQuantity = "quantity"
+	// UnitPrice 是 Result.P 分量的约定量纲。
+	UnitPrice = "price"
+	// UnitValue 是 Result.V 分量的约定量纲。
+	UnitValue = "value"
+)
+
+// ComponentUnit 返回 Result 分量（Q/P/V）的约定量纲，未知分量返回空串。
+func ComponentUnit(component string) string {
+	switch component {
+	case "Q":
+		return UnitQuantity
+	case "P":
+		return UnitPrice
+	case "V":
+		return UnitValue
+	default:
+		return ""
+	}
+}
+
+// UnitWarning 描述一个量纲不一致的公式节点。
+type UnitWarning struct {
+	Node    string
+	Units   []string
+	Message string
+}
+
+func (w UnitWarning) String() string {
+	return fmt.Sprintf("%s: %s", w.Node, w.Message)
+}
+
+// CheckUnits 对模板做尽力而为的量纲检查：输出量纲为简单量纲（不含 * 或 /）的公式被视为加减组合，
+// 其声明了量纲的依赖必须彼此一致且与公式自身量纲一致。WithHistory 等装饰器包装的公式按被包装的公式检查，
+// 输入节点依赖因无法得知读取的分量而跳过。
+func (t *CalcTemplate) CheckUnits() []UnitWarning {
+	names := make([]string, 0, len(t.registry))
+	for name := range t.registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var warnings []UnitWarning
+	for _, name := range names {
+		formula, ok := unwrapFormula(t.registry[name])
+		if !ok || strings.ContainsAny(formula.Unit, "*/") {
+			continue
+		}
+
+		seen := make(map[string]bool)
+		var units []string
+		for _, dep := range formula.deps {
+			depFormula, ok := unwrapFormula(t.registry[dep])
+			if !ok || depFormula.Unit == "" || seen[depFormula.Unit] {
+				continue
+			}
+			seen[depFormula.Unit] = true
+			units = append(units, depFormula.Unit)
+		}
+		sort.Strings(units)
+
+		switch {
+		case len(units) > 1:
+			warnings = append(warnings, UnitWarning{
+				Node:    name,
+				Units:   units,
+				Message: fmt.Sprintf("combines incompatible units %s", strings.Join(units, ", ")),
+			})
+		case len(units) == 1 && formula.Unit != "" && units[0] != formula.Unit:
+			warnings = append(warnings, UnitWarning{
+				Node:    name,
+				Units:   []string{formula.Unit, units[0]},
+				Message: fmt.Sprintf("declares unit %s but depends on %s", formula.Unit, units[0]),
+			})
+		}
+	}
+	return warnings
+}
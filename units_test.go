@@ -0,0 +1,47 @@
+package dynamicformula
+
+import "testing"
+
+func TestCheckUnits_FlagsValuePlusQuantity(t *testing.T) {
+	valueNode := FormulaNode{
+		name: "units_value",
+		deps: []string{KeyBaselineMetrics},
+		Unit: UnitValue,
+		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
+			return float64(*prev[KeyBaselineMetrics].(Result).V), nil
+		},
+	}
+	quantityNode := FormulaNode{
+		name: "units_quantity",
+		deps: []string{KeyBaselineMetrics},
+		Unit: UnitQuantity,
+		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
+			return float64(*prev[KeyBaselineMetrics].(Result).Q), nil
+		},
+	}
+	sum := FormulaNode{
+		name: "units_sum",
+		deps: []string{"units_value", "units_quantity"},
+		Unit: UnitValue,
+		formula: func(m ContextInput, prev map[string]interface{}) (float64, error) {
+			return prev["units_value"].(float64) + prev["units_quantity"].(float64), nil
+		},
+	}
+
+	warnings := NewCalcTemplate(valueNode, quantityNode, sum).CheckUnits()
+	if len(warnings) != 1 || warnings[0].Node != "units_sum" {
+		t.Fatalf("expected a single warning for units_sum, got %v", warnings)
+	}
+
+	// 装饰器包装的公式同样参与检查。
+	wrappedQuantity, _ := WithHistory(quantityNode, 2)
+	wrappedSum, _ := WithHistory(sum, 2)
+	warnings = NewCalcTemplate(valueNode, wrappedQuantity, wrappedSum).CheckUnits()
+	if len(warnings) != 1 || warnings[0].Node != "units_sum" || len(warnings[0].Units) != 2 {
+		t.Fatalf("expected a warning for wrapped units_sum, got %v", warnings)
+	}
+
+	if warnings := NewFullCalcTemplate().CheckUnits(); len(warnings) != 0 {
+		t.Fatalf("built-in formulas should be unit-consistent, got %v", warnings)
+	}
+}
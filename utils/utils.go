@@ -1,8 +1,24 @@
 package utils
 
-import "github.com/shopspring/decimal"
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/shopspring/decimal"
+)
 
 func DecimalAdd(values ...float64) float64 {
+	if anyNonFinite(values...) {
+		var sum float64
+		for _, value := range values {
+			sum += value
+		}
+		return sum
+	}
+	warnPrecisionLoss("add", values...)
 	var sum decimal.Decimal
 	for _, value := range values {
 		valueDecimal := decimal.NewFromFloat(value)
@@ -13,6 +29,10 @@ func DecimalAdd(values ...float64) float64 {
 }
 
 func DecimalSubtract(value1 float64, value2 float64) float64 {
+	if anyNonFinite(value1, value2) {
+		return value1 - value2
+	}
+	warnPrecisionLoss("subtract", value1, value2)
 	value1Decimal := decimal.NewFromFloat(value1)
 	value2Decimal := decimal.NewFromFloat(value2)
 	result, _ := value1Decimal.Sub(value2Decimal).Float64()
@@ -20,21 +40,350 @@ func DecimalSubtract(value1 float64, value2 float64) float64 {
 }
 
 func DecimalMul(value1 float64, value2 float64) float64 {
+	if anyNonFinite(value1, value2) {
+		return value1 * value2
+	}
 	if value2 == 0 {
 		return 0
 	}
+	warnPrecisionLoss("mul", value1, value2)
 	value1Decimal := decimal.NewFromFloat(value1)
 	value2Decimal := decimal.NewFromFloat(value2)
 	result, _ := value1Decimal.Mul(value2Decimal).Float64()
 	return result
 }
 
+// DivideByZeroBehavior 决定 DecimalDivide 遇到零除数时的行为。
+type DivideByZeroBehavior int
+
+const (
+	// ReturnZero 返回 0：兼容历史行为，但会把"未定义"伪装成合法的零值。
+	ReturnZero DivideByZeroBehavior = iota
+	// ReturnNaN 返回 NaN：结果可向下游传播并被 CalcOptions.RejectNonFinite 等机制捕获。
+	ReturnNaN
+	// Panic 直接 panic：最早暴露问题，但调用方需自行 recover，适合测试与排查环境。
+	Panic
+)
+
+// divideByZeroMode 是包级的零除处理模式，默认 ReturnZero，通过 SetDivideByZeroMode 原子地修改。
+var divideByZeroMode atomic.Int32
+
+// SetDivideByZeroMode 设置 DecimalDivide 的包级零除处理模式并返回原模式，可在并发计算期间安全调用。
+// DecimalMul 的零值短路（x*0=0）在数学上是精确的，不受该模式影响。
+//
+// 兼容性说明：早期版本以包级变量 DivideByZeroMode 暴露该模式，并发 Calc 读取时修改它存在数据竞争，
+// 该变量已移除，原先的赋值改为调用 SetDivideByZeroMode，读取改为 CurrentDivideByZeroMode。
+func SetDivideByZeroMode(mode DivideByZeroBehavior) DivideByZeroBehavior {
+	return DivideByZeroBehavior(divideByZeroMode.Swap(int32(mode)))
+}
+
+// CurrentDivideByZeroMode 返回当前的包级零除处理模式。
+func CurrentDivideByZeroMode() DivideByZeroBehavior {
+	return DivideByZeroBehavior(divideByZeroMode.Load())
+}
+
 func DecimalDivide(value1 float64, value2 float64, reserve int) float64 {
+	if anyNonFinite(value1, value2) {
+		return value1 / value2
+	}
 	if value2 == 0 {
-		return 0
+		switch CurrentDivideByZeroMode() {
+		case ReturnNaN:
+			return math.NaN()
+		case Panic:
+			panic(fmt.Sprintf("utils: division of %v by zero", value1))
+		default:
+			return 0
+		}
 	}
+	warnPrecisionLoss("divide", value1, value2)
 	value1Decimal := decimal.NewFromFloat(value1)
 	value2Decimal := decimal.NewFromFloat(value2)
 	result, _ := value1Decimal.Div(value2Decimal).Round(int32(reserve)).Float64()
 	return result
 }
+
+func DecimalLerp(a, b, t float64) (float64, error) {
+	if t < 0 || t > 1 {
+		return 0, fmt.Errorf("interpolation factor %v is outside [0, 1]", t)
+	}
+	return DecimalLerpUnclamped(a, b, t), nil
+}
+
+// DecimalLerpUnclamped 不限制 t 的范围，t 超出 [0, 1] 时做线性外推。
+func DecimalLerpUnclamped(a, b, t float64) float64 {
+	aDecimal := decimal.NewFromFloat(a)
+	bDecimal := decimal.NewFromFloat(b)
+	tDecimal := decimal.NewFromFloat(t)
+	result, _ := aDecimal.Add(bDecimal.Sub(aDecimal).Mul(tDecimal)).Float64()
+	return result
+}
+
+func IsOnTick(value, tick float64) (bool, error) {
+	if tick <= 0 {
+		return false, fmt.Errorf("tick must be positive, got %v", tick)
+	}
+	remainder := decimal.NewFromFloat(value).Mod(decimal.NewFromFloat(tick))
+	return remainder.IsZero(), nil
+}
+
+// DecimalSign 以十进制比较返回 -1/0/1，-0.0 视为 0；±Inf 返回 ±1，NaN 没有符号，返回 0。
+func DecimalSign(value float64) int {
+	if math.IsNaN(value) {
+		return 0
+	}
+	if math.IsInf(value, 0) {
+		if value > 0 {
+			return 1
+		}
+		return -1
+	}
+	return decimal.NewFromFloat(value).Sign()
+}
+
+// DecimalIsZero 判断 value 是否为（十进制意义上的）零，NaN 不视为零。
+func DecimalIsZero(value float64) bool {
+	return !math.IsNaN(value) && DecimalSign(value) == 0
+}
+
+func DecimalIfPositive(value, thenV, elseV float64) float64 {
+	if DecimalSign(value) > 0 {
+		return thenV
+	}
+	return elseV
+}
+
+// DecimalRound 按 places 位小数做十进制四舍五入（half away from zero），NaN 与 ±Inf 原样返回。
+func DecimalRound(value float64, places int) float64 {
+	if anyNonFinite(value) {
+		return value
+	}
+	result, _ := decimal.NewFromFloat(value).Round(int32(places)).Float64()
+	return result
+}
+
+// DecimalRoundBank 按 places 位小数做银行家舍入（half to even）：恰好位于中点时取偶数，
+// 如 0.5→0、1.5→2、2.5→2。DecimalRound 则远离零进位（2.5→3），大量中点值累加时会产生系统性偏差。
+// NaN 与 ±Inf 原样返回。
+func DecimalRoundBank(value float64, places int) float64 {
+	if anyNonFinite(value) {
+		return value
+	}
+	result, _ := decimal.NewFromFloat(value).RoundBank(int32(places)).Float64()
+	return result
+}
+
+// DecimalAllocate 按权重把 total 分配到各桶，使用最大余数法保证各部分之和严格等于 total（先按 places 舍入）。
+// 余数相同时优先补给靠后的桶。权重为空、含负数或总和为零时返回错误。
+func DecimalAllocate(total float64, weights []float64, places int) ([]float64, error) {
+	if len(weights) == 0 {
+		return nil, fmt.Errorf("no weights to allocate across")
+	}
+	weightSum := decimal.Zero
+	for _, w := range weights {
+		if w < 0 {
+			return nil, fmt.Errorf("weight %v is negative", w)
+		}
+		weightSum = weightSum.Add(decimal.NewFromFloat(w))
+	}
+	if weightSum.IsZero() {
+		return nil, fmt.Errorf("weights sum to zero")
+	}
+
+	totalDecimal := decimal.NewFromFloat(total).Round(int32(places))
+	sign := decimal.NewFromInt(int64(totalDecimal.Sign()))
+	remaining := totalDecimal.Abs()
+	unit := decimal.New(1, int32(-places))
+
+	parts := make([]decimal.Decimal, len(weights))
+	remainders := make([]decimal.Decimal, len(weights))
+	for i, w := range weights {
+		exact := totalDecimal.Abs().Mul(decimal.NewFromFloat(w)).Div(weightSum)
+		parts[i] = exact.Truncate(int32(places))
+		remainders[i] = exact.Sub(parts[i])
+		remaining = remaining.Sub(parts[i])
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		cmp := remainders[order[a]].Cmp(remainders[order[b]])
+		if cmp != 0 {
+			return cmp > 0
+		}
+		return order[a] > order[b]
+	})
+	for _, i := range order {
+		if remaining.LessThan(unit) {
+			break
+		}
+		parts[i] = parts[i].Add(unit)
+		remaining = remaining.Sub(unit)
+	}
+
+	result := make([]float64, len(parts))
+	for i, part := range parts {
+		result[i], _ = part.Mul(sign).Float64()
+	}
+	return result, nil
+}
+
+// DecimalPow 以十进制计算 base 的整数次幂，避免 math.Pow 的二进制误差。
+func DecimalPow(base float64, exponent int) (float64, error) {
+	result, err := decimal.NewFromFloat(base).PowInt32(int32(exponent))
+	if err != nil {
+		return 0, err
+	}
+	value, _ := result.Float64()
+	return value, nil
+}
+
+// DecimalCompound 计算 base*(1+rate)^periods，periods 为负时返回错误。
+func DecimalCompound(base, rate float64, periods int) (float64, error) {
+	if periods < 0 {
+		return 0, fmt.Errorf("periods must be non-negative, got %d", periods)
+	}
+	factor, err := DecimalPow(DecimalAdd(1, rate), periods)
+	if err != nil {
+		return 0, err
+	}
+	return DecimalMul(base, factor), nil
+}
+
+// DecimalCompoundSeries 返回第 1 到第 periods 期各自的复利值。
+func DecimalCompoundSeries(base, rate float64, periods int) ([]float64, error) {
+	if periods < 0 {
+		return nil, fmt.Errorf("periods must be non-negative, got %d", periods)
+	}
+	growth := decimal.NewFromFloat(1).Add(decimal.NewFromFloat(rate))
+	current := decimal.NewFromFloat(base)
+	series := make([]float64, periods)
+	for i := range series {
+		current = current.Mul(growth)
+		series[i], _ = current.Float64()
+	}
+	return series, nil
+}
+
+// Logger 接收工具函数的诊断信息，*log.Logger 即满足该接口。
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// PrecisionLogger 非空时，DecimalAdd、DecimalSubtract、DecimalMul 与 DecimalDivide 在操作数量级相差超过
+// float64 可保留的有效位数时输出精度损失警告。默认 nil，不做检查。
+var PrecisionLogger Logger
+
+// float64SignificantDigits 是 float64 能稳定保留的十进制有效位数。
+const float64SignificantDigits = 15
+
+// warnPrecisionLoss 检查非零操作数的数量级跨度：十进制运算本身是精确的，
+// 但跨度超过 15 位时加减结果转回 float64 会丢失较小的操作数；乘除法中如此悬殊的量级通常意味着量纲或比例错误，
+// 除法的商按保留位舍入时还可能被整体舍去。
+func warnPrecisionLoss(op string, values ...float64) {
+	if PrecisionLogger == nil {
+		return
+	}
+	var smallest, largest float64
+	found := false
+	for _, value := range values {
+		if value == 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		magnitude := math.Floor(math.Log10(math.Abs(value)))
+		if !found || magnitude < smallest {
+			smallest = magnitude
+		}
+		if !found || magnitude > largest {
+			largest = magnitude
+		}
+		found = true
+	}
+	if found && largest-smallest > float64SignificantDigits {
+		PrecisionLogger.Printf("utils: %s operands %v span %v orders of magnitude; result may lose precision", op, values, largest-smallest)
+	}
+}
+
+// smallestNormalFloat64 是最小的正规格化 float64，更小的非零值为次正规数。
+const smallestNormalFloat64 = 0x1p-1022
+
+// DecimalNormalize 将 value 规整到 15 位有效数字，消除 0.1+0.2 这类二进制表示噪声。
+// NaN 与 ±Inf 返回错误；次正规数（绝对值小于最小规格化数）已无可靠精度，直接归零。
+func DecimalNormalize(value float64) (float64, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("value %v is not finite", value)
+	}
+	if value == 0 || math.Abs(value) < smallestNormalFloat64 {
+		return 0, nil
+	}
+	magnitude := int32(math.Floor(math.Log10(math.Abs(value))))
+	result, _ := decimal.NewFromFloat(value).Round(float64SignificantDigits - 1 - magnitude).Float64()
+	return result, nil
+}
+
+// ReconcileRounding 返回按 places 舍入后的 total 与各分量分别舍入后之和的差额，
+// 调用方可把该差额补到某个分量上，使舍入后的分量之和与舍入后的总额一致。
+func ReconcileRounding(components []float64, total float64, places int) (float64, error) {
+	if len(components) == 0 {
+		return 0, fmt.Errorf("no components to reconcile")
+	}
+	if math.IsNaN(total) || math.IsInf(total, 0) {
+		return 0, fmt.Errorf("total %v is not finite", total)
+	}
+	sum := decimal.Zero
+	for _, c := range components {
+		if math.IsNaN(c) || math.IsInf(c, 0) {
+			return 0, fmt.Errorf("component %v is not finite", c)
+		}
+		sum = sum.Add(decimal.NewFromFloat(c).Round(int32(places)))
+	}
+	adjustment, _ := decimal.NewFromFloat(total).Round(int32(places)).Sub(sum).Float64()
+	return adjustment, nil
+}
+
+// anyNonFinite 判断是否存在 NaN 或 ±Inf。decimal 无法表示这些值，算术辅助函数遇到时
+// 退回 float64 运算，使 NaN/Inf 按 IEEE 754 语义自然传播。
+func anyNonFinite(values ...float64) bool {
+	for _, value := range values {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatFloat 以十进制格式化 value：places 为负时先规整到 15 位有效数字再输出最短形式，
+// 去掉 15.359999999999999 这类二进制噪声，但也会舍去超过 15 位的有效数字；需要保留全部精度时使用 FormatDecimal。
+// places 非负时输出固定位小数。NaN/±Inf 按 strconv 输出。
+func FormatFloat(value float64, places int) string {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+	if places >= 0 {
+		return decimal.NewFromFloat(value).StringFixed(int32(places))
+	}
+	normalized, _ := DecimalNormalize(value)
+	return decimal.NewFromFloat(normalized).String()
+}
+
+// PlacesExact 作为 FormatDecimal 的 places 时输出能精确还原该 float64 的最短十进制形式，不做任何舍入。
+const PlacesExact = -2
+
+// FormatDecimal 以十进制格式化 value：places 非负时按十进制四舍五入到固定位小数；places 为 PlacesExact 时
+// 输出能精确还原该值的最短形式，保留全部有效数字；其他负值同 FormatFloat(value, -1)，去掉二进制噪声。
+// 均不使用科学计数法，NaN/±Inf 按 strconv 输出。
+func FormatDecimal(value float64, places int) string {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+	switch {
+	case places >= 0:
+		return decimal.NewFromFloat(value).StringFixed(int32(places))
+	case places == PlacesExact:
+		return decimal.NewFromFloat(value).String()
+	default:
+		return FormatFloat(value, -1)
+	}
+}
@@ -0,0 +1,378 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestDecimalLerp(t *testing.T) {
+	cases := []struct {
+		t    float64
+		want float64
+	}{
+		{0, 18.5},
+		{1, 21.3},
+		{0.5, 19.9},
+	}
+	for _, c := range cases {
+		got, err := DecimalLerp(18.5, 21.3, c.t)
+		if err != nil {
+			t.Fatalf("t=%v: %v", c.t, err)
+		}
+		if got != c.want {
+			t.Errorf("DecimalLerp(18.5, 21.3, %v) = %v, want %v", c.t, got, c.want)
+		}
+	}
+
+	if _, err := DecimalLerp(18.5, 21.3, 1.5); err == nil {
+		t.Error("expected error for t outside [0, 1]")
+	}
+	if got := DecimalLerpUnclamped(10, 20, 1.5); got != 25 {
+		t.Errorf("DecimalLerpUnclamped(10, 20, 1.5) = %v, want 25", got)
+	}
+}
+
+func TestIsOnTick(t *testing.T) {
+	if ok, err := IsOnTick(18.75, 0.05); err != nil || !ok {
+		t.Errorf("IsOnTick(18.75, 0.05) = %v, %v; want true", ok, err)
+	}
+	if ok, err := IsOnTick(18.77, 0.05); err != nil || ok {
+		t.Errorf("IsOnTick(18.77, 0.05) = %v, %v; want false", ok, err)
+	}
+	if _, err := IsOnTick(18.75, 0); err == nil {
+		t.Error("expected error for zero tick")
+	}
+}
+
+func TestDecimalSign(t *testing.T) {
+	negZero := math.Copysign(0, -1)
+	cases := []struct {
+		value float64
+		want  int
+	}{
+		{-3.5, -1},
+		{0, 0},
+		{negZero, 0},
+		{2.25, 1},
+		{1e-20, 1},
+		{-1e-20, -1},
+	}
+	for _, c := range cases {
+		if got := DecimalSign(c.value); got != c.want {
+			t.Errorf("DecimalSign(%v) = %d, want %d", c.value, got, c.want)
+		}
+	}
+
+	if got := DecimalIfPositive(1e-20, 1, 2); got != 1 {
+		t.Errorf("DecimalIfPositive(1e-20) = %v, want 1", got)
+	}
+	if got := DecimalIfPositive(negZero, 1, 2); got != 2 {
+		t.Errorf("DecimalIfPositive(-0) = %v, want 2", got)
+	}
+}
+
+func TestDecimalDivide_ZeroDivisorModes(t *testing.T) {
+	defer SetDivideByZeroMode(SetDivideByZeroMode(ReturnZero))
+
+	if got := DecimalDivide(5, 0, 4); got != 0 {
+		t.Errorf("ReturnZero: got %v, want 0", got)
+	}
+	if got := DecimalMul(5, 0); got != 0 {
+		t.Errorf("ReturnZero: DecimalMul(5, 0) = %v, want 0", got)
+	}
+
+	if previous := SetDivideByZeroMode(ReturnNaN); previous != ReturnZero {
+		t.Errorf("SetDivideByZeroMode returned %v, want ReturnZero", previous)
+	}
+	if got := DecimalDivide(5, 0, 4); !math.IsNaN(got) {
+		t.Errorf("ReturnNaN: got %v, want NaN", got)
+	}
+	if got := DecimalMul(5, 0); got != 0 {
+		t.Errorf("ReturnNaN: DecimalMul(5, 0) = %v, mode must not affect multiplication", got)
+	}
+
+	SetDivideByZeroMode(Panic)
+	if CurrentDivideByZeroMode() != Panic {
+		t.Fatalf("CurrentDivideByZeroMode() = %v, want Panic", CurrentDivideByZeroMode())
+	}
+	if got, other := DecimalMul(5, 0), DecimalMul(0, 5); got != 0 || other != 0 {
+		t.Errorf("Panic: DecimalMul with zero = %v, %v; want 0", got, other)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Panic: expected panic on zero divisor")
+			}
+		}()
+		DecimalDivide(5, 0, 4)
+	}()
+
+	if got := DecimalDivide(5, 2, 4); got != 2.5 {
+		t.Errorf("non-zero divisor: got %v, want 2.5", got)
+	}
+}
+
+func TestDecimalRound(t *testing.T) {
+	cases := []struct {
+		value  float64
+		places int
+		want   float64
+	}{
+		{19.200000000000003, 6, 19.2},
+		{2.345, 2, 2.35},
+		{-2.345, 2, -2.35},
+		{15.5, 0, 16},
+	}
+	for _, c := range cases {
+		if got := DecimalRound(c.value, c.places); got != c.want {
+			t.Errorf("DecimalRound(%v, %d) = %v, want %v", c.value, c.places, got, c.want)
+		}
+	}
+}
+
+func TestDecimalAllocate(t *testing.T) {
+	got, err := DecimalAllocate(100, []float64{1, 1, 1}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{33.33, 33.33, 33.34}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("DecimalAllocate(100, [1 1 1], 2) = %v, want %v", got, want)
+		}
+	}
+
+	got, err = DecimalAllocate(-10, []float64{1, 2}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0] != -3.33 || got[1] != -6.67 {
+		t.Fatalf("negative total allocation = %v", got)
+	}
+	if DecimalAdd(got...) != -10 {
+		t.Fatalf("parts %v do not sum to -10", got)
+	}
+
+	if _, err := DecimalAllocate(100, nil, 2); err == nil {
+		t.Error("expected error for empty weights")
+	}
+	if _, err := DecimalAllocate(100, []float64{0, 0}, 2); err == nil {
+		t.Error("expected error for zero total weight")
+	}
+}
+
+func TestDecimalCompound(t *testing.T) {
+	got, err := DecimalCompound(100, 0.1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 133.1 {
+		t.Fatalf("DecimalCompound(100, 0.1, 3) = %v, want 133.1", got)
+	}
+
+	series, err := DecimalCompoundSeries(100, 0.1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{110, 121, 133.1}
+	for i := range want {
+		if series[i] != want[i] {
+			t.Fatalf("DecimalCompoundSeries(100, 0.1, 3) = %v, want %v", series, want)
+		}
+	}
+
+	if _, err := DecimalCompound(100, 0.1, -1); err == nil {
+		t.Fatal("expected error for negative periods")
+	}
+	if _, err := DecimalCompoundSeries(100, 0.1, -1); err == nil {
+		t.Fatal("expected error for negative periods")
+	}
+}
+
+func TestDecimalPow(t *testing.T) {
+	if got, err := DecimalPow(1.1, 2); err != nil || got != 1.21 {
+		t.Fatalf("DecimalPow(1.1, 2) = %v, %v", got, err)
+	}
+}
+
+type recordingLogger struct {
+	messages []string
+}
+
+func (l *recordingLogger) Printf(format string, args ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(format, args...))
+}
+
+func TestPrecisionLogger(t *testing.T) {
+	logger := &recordingLogger{}
+	PrecisionLogger = logger
+	defer func() { PrecisionLogger = nil }()
+
+	if got := DecimalAdd(1e6, 1e-18); got != 1e6 {
+		t.Fatalf("DecimalAdd(1e6, 1e-18) = %v", got)
+	}
+	if len(logger.messages) != 1 {
+		t.Fatalf("expected one precision warning, got %v", logger.messages)
+	}
+	DecimalSubtract(1e6, 1e-18)
+	if len(logger.messages) != 2 {
+		t.Fatalf("expected subtract to warn, got %v", logger.messages)
+	}
+
+	DecimalMul(1e6, 1e-18)
+	if len(logger.messages) != 3 {
+		t.Fatalf("expected mul to warn, got %v", logger.messages)
+	}
+	if got := DecimalDivide(1e-18, 1e6, 16); got != 0 {
+		t.Fatalf("DecimalDivide(1e-18, 1e6, 16) = %v, want 0", got)
+	}
+	if len(logger.messages) != 4 {
+		t.Fatalf("expected divide to warn, got %v", logger.messages)
+	}
+
+	DecimalAdd(1e6, 0.25, 0)
+	DecimalSubtract(1e-18, 3e-18)
+	DecimalMul(1e6, 0.25)
+	DecimalDivide(1e6, 3, 4)
+	if len(logger.messages) != 4 {
+		t.Fatalf("unexpected warnings %v", logger.messages)
+	}
+}
+
+func TestDecimalNormalize(t *testing.T) {
+	cases := []struct {
+		value float64
+		want  float64
+	}{
+		{0.1 + 0.2, 0.3},
+		{1e-18, 1e-18},
+		{1e6 + 1e-18, 1e6},
+		{1.0000000000000002e20, 1e20},
+		{5e-324, 0},
+		{0, 0},
+	}
+	for _, c := range cases {
+		got, err := DecimalNormalize(c.value)
+		if err != nil {
+			t.Fatalf("DecimalNormalize(%v): %v", c.value, err)
+		}
+		if got != c.want {
+			t.Errorf("DecimalNormalize(%v) = %v, want %v", c.value, got, c.want)
+		}
+	}
+	if _, err := DecimalNormalize(math.NaN()); err == nil {
+		t.Fatal("expected error for NaN")
+	}
+	if _, err := DecimalNormalize(math.Inf(-1)); err == nil {
+		t.Fatal("expected error for -Inf")
+	}
+}
+
+func TestReconcileRounding(t *testing.T) {
+	components := []float64{1.005, 2.005, 3.005}
+	total := DecimalAdd(components...)
+	got, err := ReconcileRounding(components, total, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 分量各自舍入为 1.01 + 2.01 + 3.01 = 6.03，总额 6.015 舍入为 6.02。
+	if got != -0.01 {
+		t.Fatalf("ReconcileRounding = %v, want -0.01", got)
+	}
+
+	if got, err := ReconcileRounding([]float64{0.5, 0.25}, 0.75, 2); err != nil || got != 0 {
+		t.Fatalf("exact components: %v, %v", got, err)
+	}
+	if _, err := ReconcileRounding(nil, 1, 2); err == nil {
+		t.Fatal("expected error for empty components")
+	}
+}
+
+func TestDecimalRoundBank(t *testing.T) {
+	for _, c := range []struct{ value, bank, halfUp float64 }{
+		{0.5, 0, 1},
+		{1.5, 2, 2},
+		{2.5, 2, 3},
+		{-2.5, -2, -3},
+	} {
+		if got := DecimalRoundBank(c.value, 0); got != c.bank {
+			t.Errorf("DecimalRoundBank(%v, 0) = %v, want %v", c.value, got, c.bank)
+		}
+		if got := DecimalRound(c.value, 0); got != c.halfUp {
+			t.Errorf("DecimalRound(%v, 0) = %v, want %v", c.value, got, c.halfUp)
+		}
+	}
+	if got := DecimalRoundBank(0.125, 2); got != 0.12 {
+		t.Errorf("DecimalRoundBank(0.125, 2) = %v, want 0.12", got)
+	}
+	if got := DecimalRoundBank(math.NaN(), 2); !math.IsNaN(got) {
+		t.Errorf("DecimalRoundBank(NaN, 2) = %v, want NaN", got)
+	}
+	if got := DecimalRound(math.Inf(-1), 2); !math.IsInf(got, -1) {
+		t.Errorf("DecimalRound(-Inf, 2) = %v, want -Inf", got)
+	}
+}
+
+func TestDecimalHelpers_NonFinitePropagation(t *testing.T) {
+	nan := math.NaN()
+	for name, got := range map[string]float64{
+		"add":      DecimalAdd(1, nan),
+		"subtract": DecimalSubtract(nan, 1),
+		"mul":      DecimalMul(nan, 0),
+		"divide":   DecimalDivide(nan, 0, 2),
+	} {
+		if !math.IsNaN(got) {
+			t.Errorf("%s = %v, want NaN", name, got)
+		}
+	}
+	if got := DecimalAdd(math.Inf(1), 1); !math.IsInf(got, 1) {
+		t.Errorf("add with +Inf = %v", got)
+	}
+	if DecimalIsZero(nan) || !DecimalIsZero(math.Copysign(0, -1)) {
+		t.Error("DecimalIsZero must reject NaN and accept -0")
+	}
+}
+
+func TestFormatFloat(t *testing.T) {
+	cases := []struct {
+		value  float64
+		places int
+		want   string
+	}{
+		{math.Nextafter(15.36, 0), -1, "15.36"},
+		{0.1 + 0.2, -1, "0.3"},
+		{16, -1, "16"},
+		{-0.000123, -1, "-0.000123"},
+		{2.5, 2, "2.50"},
+		{math.NaN(), -1, "NaN"},
+		{math.Inf(1), -1, "+Inf"},
+	}
+	for _, c := range cases {
+		if got := FormatFloat(c.value, c.places); got != c.want {
+			t.Errorf("FormatFloat(%v, %d) = %q, want %q", c.value, c.places, got, c.want)
+		}
+	}
+}
+
+func TestFormatDecimal(t *testing.T) {
+	cases := []struct {
+		value  float64
+		places int
+		want   string
+	}{
+		{math.Nextafter(15.36, 0), -1, "15.36"},
+		{math.Nextafter(15.36, 0), PlacesExact, "15.359999999999998"},
+		{math.Nextafter(15.36, 0), 2, "15.36"},
+		{123456789.12345678, PlacesExact, "123456789.12345678"},
+		{1e21, PlacesExact, "1000000000000000000000"},
+		{16, -1, "16"},
+		{2.5, 2, "2.50"},
+		{math.NaN(), PlacesExact, "NaN"},
+	}
+	for _, c := range cases {
+		if got := FormatDecimal(c.value, c.places); got != c.want {
+			t.Errorf("FormatDecimal(%v, %d) = %q, want %q", c.value, c.places, got, c.want)
+		}
+	}
+}
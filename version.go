@@ -0,0 +1,62 @@
+package dynamicformula
+
+import (
+	"strconv"
+	"strings"
+)
+
+// VersionSeparator 分隔公式名与版本号，如 "total_cost@v2"。
+const VersionSeparator = "@"
+
+// RegisterFormulaVersion 将公式按 name@version 注册，TemplateFor("total_cost@v2") 即可固定该版本。
+// 若其版本不低于当前以裸名注册的公式，裸名同时指向它，因此不带版本的请求总是解析到最新版本。
+// 版本固定只作用于模板的输出节点，依赖仍按裸名解析。Version 为空时等同于 RegisterFormula。
+func RegisterFormulaVersion(n FormulaNode) {
+	if n.Version == "" {
+		RegisterFormula(n)
+		return
+	}
+	updateRegistries(func(formulas, _ map[string]Node) {
+		formulas[n.name+VersionSeparator+n.Version] = n
+		current, ok := formulas[n.name].(FormulaNode)
+		if !ok || compareVersions(n.Version, current.Version) >= 0 {
+			formulas[n.name] = n
+		}
+	})
+}
+
+// compareVersions 按点分段比较版本号，忽略前缀 v；数字段按数值比较，其余按字典序。空版本最小。
+func compareVersions(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return -1
+	}
+	if b == "" {
+		return 1
+	}
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		ai, aErr := strconv.Atoi(as[i])
+		bi, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil && ai != bi:
+			if ai < bi {
+				return -1
+			}
+			return 1
+		case (aErr != nil || bErr != nil) && as[i] != bs[i]:
+			return strings.Compare(as[i], bs[i])
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	default:
+		return 0
+	}
+}
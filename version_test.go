@@ -0,0 +1,71 @@
+package dynamicformula
+
+import (
+	"testing"
+
+	"github.com/force-c/dynamic-formula/utils"
+)
+
+func TestRegisterFormulaVersion(t *testing.T) {
+	saved := preserveRegistries(t)
+
+	v1 := saved.formulas[KeyTotalCost].(FormulaNode)
+	v1.Version = "v1"
+	v2 := FormulaNode{
+		name:    KeyTotalCost,
+		Version: "v2",
+		Unit:    UnitValue,
+		deps:    []string{KeyBaseCost, KeySettlementImpact},
+		formula: func(_ ContextInput, prev map[string]interface{}) (float64, error) {
+			// v2 只计基础成本与正向结算影响。
+			settlement := prev[KeySettlementImpact].(float64)
+			if settlement < 0 {
+				settlement = 0
+			}
+			return utils.DecimalAdd(prev[KeyBaseCost].(float64), settlement), nil
+		},
+	}
+	RegisterFormulaVersion(v2)
+	RegisterFormulaVersion(v1)
+
+	input := samplePeriodInputs()[2]
+	for _, c := range []struct {
+		output string
+		want   float64
+	}{
+		{KeyTotalCost + "@v1", 12.015},
+		{KeyTotalCost + "@v2", 12.222},
+		{KeyTotalCost, 12.222},
+	} {
+		template, err := TemplateFor(c.output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := input.Calc(template, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		AssertResultClose(t, data, KeyTotalCost, c.want, 1e-9)
+	}
+
+	if _, err := TemplateFor(KeyTotalCost + "@v3"); err == nil {
+		t.Fatal("expected error for unknown version")
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		want int
+	}{
+		{"v1", "v2", -1},
+		{"v10", "v2", 1},
+		{"v1.2", "v1.2.1", -1},
+		{"", "v1", -1},
+		{"v2", "v2", 0},
+	} {
+		if got := compareVersions(c.a, c.b); got != c.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package dynamicformula
+
+import "fmt"
+
+// Walk 以深度优先、依赖在前的顺序访问模板中的每个节点一次。depth 为节点首次被访问时距模板根节点的层数，
+// 根节点为 0。visit 返回错误时立即停止并返回该错误。
+func (t *CalcTemplate) Walk(visit func(n Node, depth int) error) error {
+	visited := make(map[string]bool)
+	onStack := make(map[string]bool)
+
+	var walk func(n Node, depth int) error
+	walk = func(n Node, depth int) error {
+		if onStack[n.Name()] {
+			return fmt.Errorf("cycle detected at node %s", n.Name())
+		}
+		if visited[n.Name()] {
+			return nil
+		}
+		onStack[n.Name()] = true
+		for _, dep := range t.depsOf(n) {
+			next, ok := t.registry[dep]
+			if !ok {
+				return fmt.Errorf("node %s not found", dep)
+			}
+			if err := walk(next, depth+1); err != nil {
+				return err
+			}
+		}
+		onStack[n.Name()] = false
+		visited[n.Name()] = true
+		return visit(n, depth)
+	}
+
+	for _, n := range t.nodes {
+		if err := walk(n, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
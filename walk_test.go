@@ -0,0 +1,46 @@
+package dynamicformula
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCalcTemplate_Walk(t *testing.T) {
+	template := NewFullCalcTemplate()
+	position := make(map[string]int)
+	depths := make(map[string]int)
+	err := template.Walk(func(n Node, depth int) error {
+		position[n.Name()] = len(position)
+		depths[n.Name()] = depth
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(position) != 11 {
+		t.Fatalf("visited %d nodes, want 11: %v", len(position), position)
+	}
+	for name, n := range template.registry {
+		for _, dep := range n.Requires() {
+			if position[dep] >= position[name] {
+				t.Errorf("%s visited before its dependency %s", name, dep)
+			}
+		}
+	}
+	if depths[KeyBaseCost] != 0 || depths[KeyBaselineMetrics] != 1 {
+		t.Errorf("depths = %v", depths)
+	}
+
+	stop := errors.New("stop")
+	count := 0
+	err = template.Walk(func(Node, int) error {
+		count++
+		if count == 3 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || count != 3 {
+		t.Fatalf("Walk did not stop at the first visitor error: %v after %d visits", err, count)
+	}
+}
@@ -0,0 +1,80 @@
+package dynamicformula
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/force-c/dynamic-formula/utils"
+)
+
+// WarningEqualScenarioPrices 标识场景 A/B 价格相同导致结算影响与场景收益恒为零的情况。
+const WarningEqualScenarioPrices = "equal_scenario_prices"
+
+// WarningHighFanOut 标识依赖数量超过阈值的节点。
+const WarningHighFanOut = "high_fan_out"
+
+// Warning 是计算前检查产出的结构化告警，不阻止计算。
+type Warning struct {
+	Code    string
+	Message string
+	Nodes   []string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s (%s)", w.Code, w.Message, strings.Join(w.Nodes, ", "))
+}
+
+// WarnOnEqualScenarioPrices 在模板包含结算影响或场景收益、且 ScenarioAP 与 ScenarioBP 十进制相等时返回告警，
+// 此时两者的价格差为零，结果会静默地变为零。其余情况返回 nil。
+func (t *CalcTemplate) WarnOnEqualScenarioPrices(m ContextInput) *Warning {
+	var affected []string
+	for _, key := range []string{KeySettlementImpact, KeyScenarioMargin} {
+		if _, ok := t.registry[key]; ok {
+			affected = append(affected, key)
+		}
+	}
+	if len(affected) == 0 || m.ScenarioAP == nil || m.ScenarioBP == nil {
+		return nil
+	}
+	if utils.DecimalSign(utils.DecimalSubtract(float64(*m.ScenarioAP), float64(*m.ScenarioBP))) != 0 {
+		return nil
+	}
+	return &Warning{
+		Code:    WarningEqualScenarioPrices,
+		Message: fmt.Sprintf("scenario A and B prices are both %v, price-difference terms will be zero", float64(*m.ScenarioAP)),
+		Nodes:   affected,
+	}
+}
+
+// HighFanOutNodes 返回 Requires() 数量超过 threshold 的节点名，按依赖数从多到少、同数量按名称排序。
+// 仅用于模板设计检查，不影响计算。
+func (t *CalcTemplate) HighFanOutNodes(threshold int) []string {
+	var names []string
+	for name, n := range t.registry {
+		if len(n.Requires()) > threshold {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := len(t.registry[names[i]].Requires()), len(t.registry[names[j]].Requires())
+		if a != b {
+			return a > b
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// WarnOnHighFanOut 为 HighFanOutNodes 中的每个节点返回一条附带依赖数量的告警。
+func (t *CalcTemplate) WarnOnHighFanOut(threshold int) []Warning {
+	var warnings []Warning
+	for _, name := range t.HighFanOutNodes(threshold) {
+		warnings = append(warnings, Warning{
+			Code:    WarningHighFanOut,
+			Message: fmt.Sprintf("node depends on %d nodes, more than %d", len(t.registry[name].Requires()), threshold),
+			Nodes:   []string{name},
+		})
+	}
+	return warnings
+}
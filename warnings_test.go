@@ -0,0 +1,65 @@
+package dynamicformula
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWarnOnEqualScenarioPrices(t *testing.T) {
+	template := NewFullCalcTemplate()
+
+	equal := ContextInput{ScenarioAP: NewOptionalFloat(18.5), ScenarioBP: NewOptionalFloat(18.50)}
+	w := template.WarnOnEqualScenarioPrices(equal)
+	if w == nil {
+		t.Fatal("expected warning for equal scenario prices")
+	}
+	if w.Code != WarningEqualScenarioPrices || len(w.Nodes) != 2 {
+		t.Fatalf("unexpected warning %+v", w)
+	}
+
+	distinct := ContextInput{ScenarioAP: NewOptionalFloat(18.5), ScenarioBP: NewOptionalFloat(17.8)}
+	if w := template.WarnOnEqualScenarioPrices(distinct); w != nil {
+		t.Fatalf("unexpected warning for distinct prices: %v", w)
+	}
+
+	if w := NewCalcTemplate(currentRegistries().formulas[KeyBaseCost]).WarnOnEqualScenarioPrices(equal); w != nil {
+		t.Fatalf("template without settlement/margin should not warn: %v", w)
+	}
+}
+
+func TestCalcTemplate_HighFanOutNodes(t *testing.T) {
+	var nodes []Node
+	var deps []string
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("fan_in_%d", i)
+		deps = append(deps, name)
+		nodes = append(nodes, FormulaNode{
+			name:    name,
+			formula: func(ContextInput, map[string]interface{}) (float64, error) { return 1, nil },
+		})
+	}
+	wide := FormulaNode{
+		name: "wide",
+		deps: deps,
+		formula: func(ContextInput, map[string]interface{}) (float64, error) {
+			return 10, nil
+		},
+	}
+	template := NewCalcTemplate(append(nodes, wide)...)
+
+	if got := template.HighFanOutNodes(5); !reflect.DeepEqual(got, []string{"wide"}) {
+		t.Fatalf("HighFanOutNodes(5) = %v, want [wide]", got)
+	}
+	if got := template.HighFanOutNodes(10); len(got) != 0 {
+		t.Fatalf("HighFanOutNodes(10) = %v, want none", got)
+	}
+	warnings := template.WarnOnHighFanOut(5)
+	if len(warnings) != 1 || warnings[0].Code != WarningHighFanOut || !strings.Contains(warnings[0].Message, "10 nodes") {
+		t.Fatalf("WarnOnHighFanOut(5) = %v", warnings)
+	}
+	if got := NewFullCalcTemplate().HighFanOutNodes(5); len(got) != 0 {
+		t.Fatalf("built-in template flagged %v", got)
+	}
+}